@@ -6,4 +6,6 @@ require (
 	github.com/PelionIoT/maestroSpecs v2.4.0+incompatible
 	github.com/PelionIoT/mustache v0.0.0-20160804235033-6375acf62c69 // indirect
 	github.com/c-bata/go-prompt v0.2.6
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -19,6 +19,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 
 	. "github.com/PelionIoT/maestro-shell/shell"
 	"github.com/c-bata/go-prompt"
@@ -46,31 +47,130 @@ var version = "0.0.1"
 var defaultSock = "/tmp/maestroapi.sock"
 var helpString = `
 maestro shell        ver %s
---sock [socket]      Use the given socket instead of the default %s.
+usage: maestro-shell [options] [command [args...]]
+
+-s [socket]          Use the given socket instead of the default %s.
+--url [url]          Connect to maestro over http:// or https:// instead of
+                     the socket, like https://localhost:9443
+--cert [file]        With an https --url, the client certificate (PEM).
+--key [file]         With an https --url, the client certificate's key (PEM).
+--cacert [file]      With an https --url, the CA to verify maestro with (PEM).
+-c [command]         Run a single command and exit.
+-o [format]          Output format for maestro's responses: pretty, json or
+                     yaml. Any command also takes --output=<format>.
+--timeout [duration] Abandon requests to maestro after this long, like 10s
+                     (default 30s, 0 for no timeout). In the shell, Ctrl-C
+                     cancels the request in progress.
+-f [file]            Run the commands in a script file and exit.
+--continue-on-error  With -f, keep going after a command fails.
+--history [file]     Where the shell keeps its command history (default
+                     ~/%s, empty for none). Up and down
+                     go through it, Ctrl-R searches it.
+
+If a command is given, either with -c or as arguments, it is run and the
+shell exits with a non-zero status if the command failed.
 `
 
 func main() {
 	help := flag.Bool("h", false, "print help & options")
 	sockSet := flag.String("s", defaultSock, "Use maestro socket [path]")
+	apiURL := flag.String("url", "", "Connect to maestro at [url] instead of the socket")
+	certFile := flag.String("cert", "", "Client certificate [file] for an https url")
+	keyFile := flag.String("key", "", "Client certificate key [file] for an https url")
+	caFile := flag.String("cacert", "", "CA certificate [file] to verify an https url")
+	command := flag.String("c", "", "Run a single command and exit")
+	script := flag.String("f", "", "Run the commands in a script [file] and exit")
+	timeout := flag.Duration("timeout", DefaultRequestTimeout, "Abandon requests to maestro after [duration]")
+	output := flag.String("o", "pretty", "Output format [json|yaml|pretty]")
+	continueOnError := flag.Bool("continue-on-error", false, "With -f, keep going after a command fails")
+	historyFile := flag.String("history", DefaultHistoryPath(), "Keep the shell's command history in [file]")
 	flag.Parse()
 
 	if *help {
-		fmt.Printf(helpString, version, defaultSock)
+		fmt.Printf(helpString, version, defaultSock, DefaultHistoryFile)
 		os.Exit(0)
 	}
 
-	client, err := NewUnixClient(*sockSet)
+	if err := SetOutputMode(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var client *MaestroClient
+	var err error
+	if len(*apiURL) > 0 {
+		tlsConfig, err2 := NewTLSConfig(*certFile, *keyFile, *caFile)
+		if err2 != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err2.Error())
+			os.Exit(1)
+		}
+		client, err = NewHTTPClient(*apiURL, tlsConfig)
+	} else {
+		if len(*certFile) > 0 || len(*keyFile) > 0 || len(*caFile) > 0 {
+			fmt.Fprintf(os.Stderr, "--cert, --key and --cacert need an https --url\n")
+			os.Exit(1)
+		}
+		client, err = NewUnixClient(*sockSet)
+	}
 
 	if err != nil {
-		fmt.Errorf("Failed to create connection to maestro: %s", err.Error())
+		fmt.Fprintf(os.Stderr, "Failed to create connection to maestro: %s\n", err.Error())
 		os.Exit(1)
 	}
 
+	if !client.IsConnected() {
+		fmt.Fprintf(os.Stderr, "Could not connect to maestro: %s\n", client.LastConnectError())
+	}
+
+	client.SetTimeout(*timeout)
 	SetDefaultClient(client)
 
+	if len(*script) > 0 {
+		// RunScript prints its own errors
+		if err = RunScript(*script, *continueOnError); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if len(*command) > 0 || flag.NArg() > 0 {
+		if len(*command) > 0 {
+			err = Execute(*command)
+		} else {
+			err = ExecuteArgs(flag.Args())
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// in the shell, Ctrl-C cancels the request in progress rather than
+	// killing the shell
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			client.CancelRequests()
+		}
+	}()
+
+	SetInteractive(true)
+	client.StartReconnectLoop()
+
+	var history []string
+	if len(*historyFile) > 0 {
+		if history, err = LoadHistory(*historyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read history: %s\n", err.Error())
+		}
+	}
+
 	p := prompt.New(
 		Executor,
 		Completer,
+		prompt.OptionLivePrefix(LivePrefix),
+		prompt.OptionHistory(history),
+		prompt.OptionAddKeyBind(prompt.KeyBind{Key: prompt.ControlR, Fn: ReverseSearchHistory}),
 	)
 	p.Run()
 }
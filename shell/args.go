@@ -0,0 +1,131 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var errors_unterminated_quote = errors.New("Unterminated quote")
+var errors_trailing_backslash = errors.New("Trailing backslash")
+
+// token is an argument, and where it is in the line it was split from:
+// line[start:end] is the argument as typed, with any quotes and escapes
+type token struct {
+	text  string
+	start int
+	end   int
+}
+
+// tokenize splits a command line into arguments, following the usual shell
+// rules: runs of whitespace separate arguments, single quotes keep
+// everything literally, double quotes keep everything except \" and \\,
+// and outside of quotes a backslash escapes the next character.
+// If the line ends inside an argument, open is true. err reports an
+// unterminated quote or trailing backslash, in which case args still
+// holds everything up to the end of the line.
+func tokenize(line string) (args []string, open bool, err error) {
+	var tokens []token
+	tokens, open, err = scanTokens(line)
+	for _, t := range tokens {
+		args = append(args, t.text)
+	}
+	return
+}
+
+// scanTokens is tokenize, also giving where each argument is in line
+func scanTokens(line string) (tokens []token, open bool, err error) {
+	var cur strings.Builder
+	inToken := false
+	start := 0
+	var quote rune
+	escaped := false
+
+	for i, r := range line {
+		if !inToken && !unicode.IsSpace(r) {
+			start = i
+		}
+		switch {
+		case escaped:
+			// in double quotes, a backslash before anything else is kept
+			if quote == '"' && r != '"' && r != '\\' {
+				cur.WriteRune('\\')
+			}
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			inToken = true
+			escaped = true
+		case r == '\'' || r == '"':
+			inToken = true
+			quote = r
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token{text: cur.String(), start: start, end: i})
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			inToken = true
+			cur.WriteRune(r)
+		}
+	}
+
+	if inToken {
+		tokens = append(tokens, token{text: cur.String(), start: start, end: len(line)})
+		open = true
+	}
+	if quote != 0 {
+		err = errors_unterminated_quote
+	} else if escaped {
+		err = errors_trailing_backslash
+	}
+	return
+}
+
+// SplitArgs splits a command line into arguments. It is what Executor
+// uses, so quoted values like WifiSsid="Office Guest" arrive as one argument.
+func SplitArgs(line string) ([]string, error) {
+	args, _, err := tokenize(line)
+	return args, err
+}
+
+// completionArgs splits the text before the cursor the same way SplitArgs
+// does. If the text ends between arguments, an empty last argument is
+// added, as that is the word being completed.
+func completionArgs(text string) []string {
+	args, open, _ := tokenize(text)
+	if !open {
+		args = append(args, "")
+	}
+	return args
+}
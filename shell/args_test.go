@@ -0,0 +1,92 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+		open bool
+		err  error
+	}{
+		{line: "", args: nil},
+		{line: "   ", args: nil},
+		{line: "net get-dns", args: []string{"net", "get-dns"}, open: true},
+		{line: "  net \t  get-dns  ", args: []string{"net", "get-dns"}},
+		{line: "a '' b", args: []string{"a", "", "b"}, open: true},
+		{line: `""`, args: []string{""}, open: true},
+		{line: "a '' ", args: []string{"a", ""}},
+		{line: `'a b' c`, args: []string{"a b", "c"}, open: true},
+		{line: `'a\b "c"'`, args: []string{`a\b "c"`}, open: true},
+		{line: `WifiSsid="Office Guest" x`, args: []string{"WifiSsid=Office Guest", "x"}, open: true},
+		{line: `a\ b`, args: []string{"a b"}, open: true},
+		{line: `\'a\" \\`, args: []string{`'a"`, `\`}, open: true},
+		{line: `"a \"q\" \\ b"`, args: []string{`a "q" \ b`}, open: true},
+		{line: `"C:\certs\ca.pem"`, args: []string{`C:\certs\ca.pem`}, open: true},
+		{line: `x "unterminated`, args: []string{"x", "unterminated"}, open: true, err: errors_unterminated_quote},
+		{line: `'unterminated \`, args: []string{`unterminated \`}, open: true, err: errors_unterminated_quote},
+		{line: `"escaped end\`, args: []string{"escaped end"}, open: true, err: errors_unterminated_quote},
+		{line: `abc\`, args: []string{"abc"}, open: true, err: errors_trailing_backslash},
+		{line: `abc \`, args: []string{"abc", ""}, open: true, err: errors_trailing_backslash},
+	}
+	for _, tt := range tests {
+		args, open, err := tokenize(tt.line)
+		if !reflect.DeepEqual(args, tt.args) || open != tt.open || err != tt.err {
+			t.Errorf("tokenize(%q) = %q, %v, %v; want %q, %v, %v", tt.line, args, open, err, tt.args, tt.open, tt.err)
+		}
+	}
+}
+
+func TestScanTokensPositions(t *testing.T) {
+	line := `net  WifiPassword="a b" x\ y`
+	tokens, _, err := scanTokens(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"net", `WifiPassword="a b"`, `x\ y`}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		if typed := line[tok.start:tok.end]; typed != want[i] {
+			t.Errorf("token %d is %q in the line, want %q", i, typed, want[i])
+		}
+	}
+}
+
+func TestCompletionArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		args []string
+	}{
+		{text: "", args: []string{""}},
+		{text: "net", args: []string{"net"}},
+		{text: "net ", args: []string{"net", ""}},
+		{text: "net config-interface IfName=e", args: []string{"net", "config-interface", "IfName=e"}},
+		{text: `net config-interface WifiSsid="Office G`, args: []string{"net", "config-interface", "WifiSsid=Office G"}},
+		{text: `net config-interface WifiSsid="Office Guest" `, args: []string{"net", "config-interface", "WifiSsid=Office Guest", ""}},
+	}
+	for _, tt := range tests {
+		if args := completionArgs(tt.text); !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("completionArgs(%q) = %q, want %q", tt.text, args, tt.args)
+		}
+	}
+}
@@ -18,15 +18,21 @@ package shell
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"reflect"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PelionIoT/maestroSpecs"
 )
@@ -39,57 +45,115 @@ type MaestroClient struct {
 	tr       *http.Transport // used to cancel requests
 	// see: https://stackoverflow.com/questions/29197685/how-to-close-abort-a-golang-http-client-post-prematurely
 	connected bool
+	// guards connected, lastConnectErr, reconnectRunning and the network
+	// events subscription below
+	stateLock        sync.Mutex
+	lastConnectErr   error
+	reconnectRunning bool
+
+	// timeout is applied to every request which is not a long poll
+	timeout time.Duration
+	// cancel funcs for requests in flight, see CancelRequests()
+	inflightLock  sync.Mutex
+	inflight      map[int]context.CancelFunc
+	nextRequestID int
 
 	netEventsSubscribeID string
 	//	netEventsIntervalSeconds time.Duration
 	netEventsListenerRunning bool
+	// true once network events are subscribed to, so they can be
+	// subscribed to again after maestro restarts
+	netEventsWanted bool
+	netEventHandler NetEventHandler
 }
 
 const (
 	defaultHttpTimeoutSeconds = 30 // seconds
 )
 
-func (self *MaestroClient) post(uri string, body []byte) (resp *http.Response, err error) {
-	req, err2 := http.NewRequest(http.MethodPost, "http://unix"+uri, bytes.NewReader(body))
-	if err2 != nil {
-		err = err2
-		return
+// DefaultRequestTimeout is the timeout a new client uses
+const DefaultRequestTimeout = time.Duration(defaultHttpTimeoutSeconds) * time.Second
+
+// SetTimeout sets how long a request may take before it is abandoned.
+// Zero means no timeout.
+func (self *MaestroClient) SetTimeout(timeout time.Duration) {
+	self.timeout = timeout
+}
+
+// requestContext returns a context for a single request, which times out
+// after the client's timeout and can be cancelled with CancelRequests().
+// The returned cancel func must always be called.
+func (self *MaestroClient) requestContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if self.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), self.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
 	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	resp, err = self.httpc.Do(req)
-	if err != nil {
-		return
+
+	self.inflightLock.Lock()
+	if self.inflight == nil {
+		self.inflight = map[int]context.CancelFunc{}
 	}
-	DebugOut("http resp:%+v", resp)
-	if resp == nil {
-		err = errors.New("nil response.")
+	id := self.nextRequestID
+	self.nextRequestID++
+	self.inflight[id] = cancel
+	self.inflightLock.Unlock()
+
+	return ctx, func() {
+		self.inflightLock.Lock()
+		delete(self.inflight, id)
+		self.inflightLock.Unlock()
+		cancel()
 	}
-	return
 }
 
-func (self *MaestroClient) get(uri string) (resp *http.Response, err error) {
-	resp, err = self.httpc.Get("http://unix" + uri)
-	if err != nil {
-		return
+// CancelRequests cancels every request in flight, other than long polls
+// such as the network events listener. It returns how many were cancelled.
+func (self *MaestroClient) CancelRequests() (n int) {
+	self.inflightLock.Lock()
+	for id, cancel := range self.inflight {
+		cancel()
+		delete(self.inflight, id)
+		n++
 	}
-	DebugOut("http resp:%+v", resp)
-	if resp == nil {
-		err = errors.New("nil response.")
+	self.inflightLock.Unlock()
+	if n > 0 && self.tr != nil {
+		self.tr.CloseIdleConnections()
 	}
 	return
 }
 
-func (self *MaestroClient) put(uri string, body []byte) (resp *http.Response, err error) {
-	req, err2 := http.NewRequest(http.MethodPut, "http://unix"+uri, bytes.NewReader(body))
+func (self *MaestroClient) do(ctx context.Context, method string, uri string, body []byte) (resp *http.Response, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err2 := http.NewRequestWithContext(ctx, method, self.url+uri, reader)
 	if err2 != nil {
 		err = err2
 		return
 	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	start := time.Now()
 	resp, err = self.httpc.Do(req)
 	if err != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			// maestro is slow rather than gone, probe() decides if it is
+			// still connected
+			err = fmt.Errorf("%s %s timed out after %s", method, uri, time.Since(start).Round(100*time.Millisecond))
+		case context.Canceled:
+			err = fmt.Errorf("%s %s cancelled", method, uri)
+		default:
+			self.setConnected(false, err)
+		}
 		return
 	}
+	self.setConnected(true, nil)
 	DebugOut("http resp:%+v", resp)
 	if resp == nil {
 		err = errors.New("nil response.")
@@ -97,56 +161,156 @@ func (self *MaestroClient) put(uri string, body []byte) (resp *http.Response, er
 	return
 }
 
-func (self *MaestroClient) delete(uri string, body []byte) (resp *http.Response, err error) {
-	req, err2 := http.NewRequest(http.MethodDelete, "http://unix"+uri, bytes.NewReader(body))
-	if err2 != nil {
-		err = err2
-		return
-	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	resp, err = self.httpc.Do(req)
-	if err != nil {
-		return
-	}
-	DebugOut("http resp:%+v", resp)
-	if resp == nil {
-		err = errors.New("nil response.")
+func (self *MaestroClient) post(ctx context.Context, uri string, body []byte) (resp *http.Response, err error) {
+	return self.do(ctx, http.MethodPost, uri, body)
+}
+
+func (self *MaestroClient) get(ctx context.Context, uri string) (resp *http.Response, err error) {
+	return self.do(ctx, http.MethodGet, uri, nil)
+}
+
+// getBody does a GET and returns the whole response body, as maestro
+// sent it, for callers which show the raw response
+func (self *MaestroClient) getBody(uri string) (body []byte, err error) {
+	ctx, cancel := self.requestContext()
+	defer cancel()
+	resp, err := self.get(ctx, uri)
+	if err == nil {
+		defer resp.Body.Close()
+		DebugOut("resp.Body = %+v", resp.Body)
+		body, err = ioutil.ReadAll(resp.Body)
+		DebugOut("resp.Body body = %s", string(body))
+		if err != nil {
+			DebugOut("Error on ReadAll %s", err.Error())
+		} else {
+			err = responseError(http.MethodGet, uri, resp, body)
+		}
 	}
 	return
 }
 
+func (self *MaestroClient) put(ctx context.Context, uri string, body []byte) (resp *http.Response, err error) {
+	return self.do(ctx, http.MethodPut, uri, body)
+}
+
+func (self *MaestroClient) delete(ctx context.Context, uri string, body []byte) (resp *http.Response, err error) {
+	return self.do(ctx, http.MethodDelete, uri, body)
+}
+
 func NewUnixClient(path string) (ret *MaestroClient, err error) {
 	ret = new(MaestroClient)
+	ret.timeout = DefaultRequestTimeout
 	// ret.netEventsIntervalSeconds = time.Duration(defaultNetEventsListenTimeoutSeconds) * time.Second
 	DebugOut("creating client on UNIX sock: %s", path)
+	ret.unixPath = path
+	// the host is ignored, as every connection is dialed to the socket
+	ret.url = "http://unix"
 
 	ret.tr = &http.Transport{
-		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-			return net.Dial("unix", path)
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
 		},
 	}
 	ret.httpc = http.Client{
 		Transport: ret.tr,
 	}
 
+	// only to find out if maestro is there, see IsConnected()
+	ret.probe()
+	return
+}
+
+// NewHTTPClient creates a client for a maestro API served over TCP, such as
+// http://localhost:9443 or https://gateway:9443. tlsConfig is only used for
+// https and may be nil to use the system defaults.
+func NewHTTPClient(apiURL string, tlsConfig *tls.Config) (ret *MaestroClient, err error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = fmt.Errorf("Unsupported URL scheme %q, must be http or https", u.Scheme)
+		return
+	}
+	if len(u.Host) == 0 {
+		err = fmt.Errorf("Missing host in URL %s", apiURL)
+		return
+	}
+	if u.Scheme == "http" && tlsConfig != nil && (len(tlsConfig.Certificates) > 0 || tlsConfig.RootCAs != nil) {
+		err = fmt.Errorf("Certificates are only used with an https URL, not %s", apiURL)
+		return
+	}
+	ret = new(MaestroClient)
+	ret.timeout = DefaultRequestTimeout
+	DebugOut("creating client on URL: %s", apiURL)
+	ret.url = strings.TrimRight(u.String(), "/")
+
+	// maestro is always addressed directly, so HTTP_PROXY and HTTPS_PROXY
+	// are ignored, and requests and client certificates never go through one
+	ret.tr = &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	ret.httpc = http.Client{
+		Transport: ret.tr,
+	}
+
+	// only to find out if maestro is there, see IsConnected()
+	ret.probe()
+	return
+}
+
+// NewTLSConfig builds a TLS config for NewHTTPClient. If certFile and keyFile
+// are set, they are used as the client certificate. If caFile is set, the
+// server must have a certificate signed by it, rather than by a system CA.
+func NewTLSConfig(certFile string, keyFile string, caFile string) (config *tls.Config, err error) {
+	config = &tls.Config{}
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			err = errors.New("A client certificate needs both a cert and a key file")
+			return
+		}
+		cert, err2 := tls.LoadX509KeyPair(certFile, keyFile)
+		if err2 != nil {
+			err = fmt.Errorf("Failed to load client certificate: %s", err2.Error())
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(caFile) > 0 {
+		pem, err2 := ioutil.ReadFile(caFile)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("No certificates found in %s", caFile)
+			return
+		}
+		config.RootCAs = pool
+	}
 	return
 }
 
 type AliveResponse struct {
-	Ok     bool
-	Uptime int64
+	Ok bool `json:"ok"`
+	// Uptime is in nanoseconds
+	Uptime int64 `json:"uptime"`
 }
 
 func (self *MaestroClient) GetAlive() (alive *AliveResponse, err error) {
-	resp, err := self.get("/alive")
+	ctx, cancel := self.requestContext()
+	defer cancel()
+	resp, err := self.get(ctx, "/alive")
 	if err == nil {
+		defer resp.Body.Close()
 		DebugOut("resp.Body = %+v", resp.Body)
 		body, err2 := ioutil.ReadAll(resp.Body)
 		DebugOut("resp.Body body = %+v", body)
 		DebugOut("resp.Body body = %s", string(body))
 		if err2 == nil {
-			alive = &AliveResponse{}
-			json.Unmarshal(body, alive)
+			alive, err = decodeAlive(resp, body)
 		} else {
 			DebugOut("Error on ReadAll %s", err2.Error())
 			err = err2
@@ -155,305 +319,181 @@ func (self *MaestroClient) GetAlive() (alive *AliveResponse, err error) {
 	return
 }
 
-func FormatJsonEasyRead(out bytes.Buffer, rawjson []byte) (outs string, err error) {
-	var data interface{}
-
-	var mapfromjson func(m map[string]interface{}, level int)
-	var fromjson func(d interface{}, level int)
-	fromjson = func(d interface{}, level int) {
-		space := strings.Repeat(" ", level*4)
-		switch val := d.(type) {
-		case []interface{}:
-			for i, u := range val {
-				out.WriteString(fmt.Sprintf("[%d]: ", i))
-				fromjson(u, level)
-			}
-		case map[string]interface{}:
-			m, ok := d.(map[string]interface{})
-			if ok {
-				out.WriteString("{\n")
-				mapfromjson(m, level+1)
-				out.WriteString(fmt.Sprintf("%s}\n", space))
-			} else {
-				err = errors.New(fmt.Sprintf("generic JSON decode went to unknown type. %s", reflect.TypeOf(d)))
-			}
-		case nil:
-			out.WriteString("null")
-		case bool:
-			if val {
-				out.WriteString("true")
-			} else {
-				out.WriteString("false")
-			}
-		case string:
-			out.WriteString(fmt.Sprintf("\"%s\"", d.(string)))
-		case float64:
-			out.WriteString(fmt.Sprintf("%f", d.(float64)))
-		case int:
-			out.WriteString(fmt.Sprintf("%d", d.(int)))
-		case int64:
-			out.WriteString(fmt.Sprintf("%d", d.(int64)))
-		default:
-			out.WriteString(fmt.Sprintf("<can't handle type. %s>", reflect.TypeOf(d)))
+// sendJSON does a request with in, if not nil, as the JSON body, and
+// decodes the JSON response into out, if not nil
+func (self *MaestroClient) sendJSON(method string, uri string, in interface{}, out interface{}) (err error) {
+	var body []byte
+	if in != nil {
+		if body, err = json.Marshal(in); err != nil {
+			return
 		}
 	}
+	ctx, cancel := self.requestContext()
+	defer cancel()
+	return self.sendJSONContext(ctx, method, uri, body, out)
+}
 
-	mapfromjson = func(m map[string]interface{}, level int) {
-		space := strings.Repeat(" ", level*4)
-		for k, v := range m {
-			switch vv := v.(type) {
-			// case string:
-			// 	out.WriteString(fmt.Sprintf("%s%s: \"%s\"\n", space, k, v.(string)))
-			// 	//				fmt.Println(k, "is string", vv)
-			// case float64:
-			// 	out.WriteString(fmt.Sprintf("%s%s: ", space, k, v.(float64)))
-			// 	//				fmt.Println(k, "is float64", vv)
-			// case int:
-			// 	out.WriteString(fmt.Sprintf("%s%s: %d\n", space, k, v.(int)))
-			// case int64:
-			// 	out.WriteString(fmt.Sprintf("%s%s: %d\n", space, k, v.(int64)))
-			// 	//				fmt.Println(k, "is float64", vv)
-			case map[string]interface{}:
-				out.WriteString(fmt.Sprintf("%s%s: {\n", space, k))
-				mapfromjson(v.(map[string]interface{}), level+1)
-				out.WriteString(fmt.Sprintf("%s}\n", space))
-			case []interface{}:
-				//				fmt.Println(k, "is an array:")
-				out.WriteString(fmt.Sprintf("%s%s: []", space, k))
-				for i, u := range vv {
-					out.WriteString(fmt.Sprintf("[%d]: ", i))
-					fromjson(u, level+1)
-					out.WriteString("\n")
-					//					fmt.Println(i, u)
-				}
-			default:
-				out.WriteString(fmt.Sprintf("%s%s: ", space, k))
-				fromjson(v, level)
-				out.WriteString("\n")
-				//				fmt.Println(k, " - can't handle type. %s", reflect.TypeOf(v))
-			}
-		}
-
+// sendJSONContext is sendJSON with an already marshalled body, under ctx
+// rather than the client's timeout
+func (self *MaestroClient) sendJSONContext(ctx context.Context, method string, uri string, body []byte, out interface{}) (err error) {
+	resp, err := self.do(ctx, method, uri, body)
+	if err != nil {
+		return
 	}
-
-	err = json.Unmarshal(rawjson, &data)
-	if err == nil {
-		out.WriteString("\n")
-		fromjson(data, 0)
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	DebugOut("resp.Body body = %s", string(respBody))
+	if err != nil {
+		return
+	}
+	if err = responseError(method, uri, resp, respBody); err != nil {
+		return
+	}
+	if out != nil && len(bytes.TrimSpace(respBody)) > 0 {
+		err = json.Unmarshal(respBody, out)
 	}
-
-	outs = out.String()
-
 	return
 }
 
-func (self *MaestroClient) AddDNS(args []string) (string, error) {
-	// the struct to send to maestro
-	var dns = new(maestroSpecs.NetworkConfigPayload)
+// networking
 
-	// we need parameters
-	if len(args)-2 <= 0 {
-		return "Incorrect number of opts:", errors.New("Missing interface options")
+// AddDNS adds a nameserver to maestro's DNS config
+func (self *MaestroClient) AddDNS(server string) error {
+	if len(server) < 1 {
+		return errors.New("Missing nameserver")
 	}
+	dns := maestroSpecs.NetworkConfigPayload{Nameservers: []string{server}}
+	return self.sendJSON(http.MethodPost, "/net/dns", &dns, nil)
+}
 
-	// add the dns server
-	dns.Nameservers = append(dns.Nameservers, args[2])
+// GetDNS returns maestro's DNS config
+func (self *MaestroClient) GetDNS() (dns *maestroSpecs.NetworkConfigPayload, err error) {
+	body, err := self.getBody("/net/dns")
+	if err == nil {
+		dns, err = decodeDNS(body)
+	}
+	return
+}
 
-	bytes, err := json.Marshal(dns)
+// decodeDNS accepts either a network config or a plain list of nameservers
+func decodeDNS(body []byte) (dns *maestroSpecs.NetworkConfigPayload, err error) {
+	dns = new(maestroSpecs.NetworkConfigPayload)
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		err = json.Unmarshal(body, &dns.Nameservers)
+	} else {
+		err = json.Unmarshal(body, dns)
+	}
 	if err != nil {
-		return "Failed to encode to JSON", err
+		dns = nil
 	}
-
-	resp, err2 := self.post("/net/dns", bytes)
-
-	return resp.Status, err2
+	return
 }
 
-func (self *MaestroClient) GetDNS() (out string, err error) {
-
-	resp, err := self.get("/net/dns")
-
-	var buf bytes.Buffer
-	if err == nil {
-		DebugOut("resp.Body = %+v", resp.Body)
-		body, err2 := ioutil.ReadAll(resp.Body)
-		DebugOut("resp.Body body = %+v", body)
-		DebugOut("resp.Body body = %s", string(body))
-		if err2 == nil {
-			buf.WriteString("nameservers:")
-			out, err = FormatJsonEasyRead(buf, body)
-		} else {
-			DebugOut("Error on ReadAll %s", err2.Error())
-			err = err2
-		}
+// DeleteDNS removes a nameserver from maestro's DNS config
+func (self *MaestroClient) DeleteDNS(server string) error {
+	if len(server) < 1 {
+		return errors.New("Missing nameserver")
 	}
+	dns := maestroSpecs.NetworkConfigPayload{Nameservers: []string{server}}
+	return self.sendJSON(http.MethodDelete, "/net/dns", &dns, nil)
+}
 
-	return
+// ConfigNetInterface sends the config for a single interface to maestro
+func (self *MaestroClient) ConfigNetInterface(config maestroSpecs.NetIfConfigPayload) error {
+	return self.ConfigNetInterfaceWithAuth(config, nil)
 }
 
-func (self *MaestroClient) DeleteDNS(args []string) (string, error) {
-	// the struct to send to maestro
-	var dns = new(maestroSpecs.NetworkConfigPayload)
+// netIfConfigWithAuth sends auth in place of the empty IEEE8021x of config
+type netIfConfigWithAuth struct {
+	maestroSpecs.NetIfConfigPayload
+	IEEE8021x *IEEE8021xConfig `json:"ieee8021x"`
+}
 
-	// we need parameters
-	if len(args)-2 <= 0 {
-		return "Incorrect number of opts:", errors.New("Missing interface options")
+// ConfigNetInterfaceWithAuth sends the config for a single interface to
+// maestro, with its 802.1X authentication, if auth is not nil
+func (self *MaestroClient) ConfigNetInterfaceWithAuth(config maestroSpecs.NetIfConfigPayload, auth *IEEE8021xConfig) error {
+	if config.IfName == "" {
+		return errors.New("Missing IfName")
 	}
+	configs := []netIfConfigWithAuth{{NetIfConfigPayload: config, IEEE8021x: auth}}
+	return self.sendJSON(http.MethodPut, "/net/interfaces", configs, nil)
+}
 
-	// add the dns server
-	dns.Nameservers = append(dns.Nameservers, args[2])
+// GetNetInterfaces returns the config of every interface maestro manages
+func (self *MaestroClient) GetNetInterfaces() (interfaces []maestroSpecs.NetIfConfigPayload, err error) {
+	err = self.sendJSON(http.MethodGet, "/net/interfaces", nil, &interfaces)
+	return
+}
 
-	bytes, err := json.Marshal(dns)
-	if err != nil {
-		return "Failed to encode to JSON", err
-	}
+// GetNetInterfacesContext is GetNetInterfaces under ctx, rather than the
+// client's timeout. It is not cancelled by CancelRequests.
+func (self *MaestroClient) GetNetInterfacesContext(ctx context.Context) (interfaces []maestroSpecs.NetIfConfigPayload, err error) {
+	err = self.sendJSONContext(ctx, http.MethodGet, "/net/interfaces", nil, &interfaces)
+	return
+}
 
-	resp, err2 := self.delete("/net/dns", bytes)
+// ConnectivityTestResult is the outcome of the last outbound connectivity
+// test maestro ran on an interface, see TestHttpsRouteOut and
+// TestICMPv4EchoOut in maestroSpecs.NetIfConfigPayload
+type ConnectivityTestResult struct {
+	// Test is "https" or "icmpv4"
+	Test   string `json:"test"`
+	Target string `json:"target"`
+	Ok     bool   `json:"ok"`
+	// LastRun is when maestro last ran the test, in RFC 3339 format
+	LastRun string `json:"last_run"`
+	Error   string `json:"error,omitempty"`
+}
 
-	return resp.Status, err2
+// connectivityURI is where maestro reports the connectivity tests of ifname
+func connectivityURI(ifname string) string {
+	return fmt.Sprintf("/net/interfaces/%s/connectivity", url.PathEscape(ifname))
 }
 
-func (self *MaestroClient) ConfigNetInterface(args []string) (string, error) {
-	var netIfConfig maestroSpecs.NetIfConfigPayload
+// GetConnectivityTests returns the result of each connectivity test
+// configured on the interface
+func (self *MaestroClient) GetConnectivityTests(ifname string) (results []ConnectivityTestResult, err error) {
+	err = self.sendJSON(http.MethodGet, connectivityURI(ifname), nil, &results)
+	return
+}
 
-	// check for addition args beyond "net config-interface"
-	if len(args)-2 <= 0 {
-		return "Incorrect number of opts:", errors.New("Missing interface options")
-	}
+// logging
 
-	for _, opt := range args[2:] {
-		val := strings.Split(opt, "=")
-		if len(val) < 2 {
-			return "Invalid option", fmt.Errorf("Invalid option: %s", val)
-		}
-		DebugOut("opt=%s, arg=%s", val[0], val[1])
-		//TODO: netIfConfig.AliasAddrV4
-		//TODO: netIfConfig.IEEE8021x
-		//TODO: netIfConfig.Routes
-		//TODO: netIfConfig.TestHttpsRouteOut
-		//TODO: netIfConfig.TestICMPv4EchoOut
-		switch strings.ToLower(val[0]) {
-		case "type":
-			netIfConfig.Type = val[1]
-		case "ifname":
-			netIfConfig.IfName = val[1]
-		case "ifindex":
-			i, err := strconv.Atoi(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.IfIndex = i
-		case "dhcpv4enabled":
-			b, err := strconv.ParseBool(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.DhcpV4Enabled = b
-		case "ipv4addr":
-			netIfConfig.IPv4Addr = val[1]
-		case "ipv4mask":
-			i, err := strconv.Atoi(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.IPv4Mask = i
-		case "ipv4bcast":
-			netIfConfig.IPv4BCast = val[1]
-		case "ipv6addr":
-			netIfConfig.IPv6Addr = val[1]
-		case "hwaddr":
-			netIfConfig.IPv6Addr = val[1]
-		case "replaceaddress":
-			netIfConfig.ReplaceAddress = val[1]
-		case "clearaddresses":
-			b, err := strconv.ParseBool(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.ClearAddresses = b
-		case "wifissid":
-			netIfConfig.WifiSsid = val[1]
-		case "wifipassword":
-			netIfConfig.WifiPassword = val[1]
-		case "down":
-			b, err := strconv.ParseBool(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.Down = b
-		case "defaultgateway":
-			netIfConfig.DefaultGateway = val[1]
-		case "fallbackdefaultgateway":
-			netIfConfig.FallbackDefaultGateway = val[1]
-		case "routepriority":
-			i, err := strconv.Atoi(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.RoutePriority = i
-		case "aux":
-			b, err := strconv.ParseBool(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.Aux = b
-		case "nameserveroverrides":
-			netIfConfig.NameserverOverrides = val[1]
-		case "dhcpdisableclearaddresses":
-			b, err := strconv.ParseBool(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.DhcpDisableClearAddresses = b
-		case "dhcpsteptimeout":
-			i, err := strconv.Atoi(val[1])
-			if err != nil {
-				return "Invalid argument", err
-			}
-			netIfConfig.DhcpStepTimeout = i
-		case "existing":
-			netIfConfig.Existing = val[1]
-		case "serialdevice":
-			netIfConfig.SerialDevice = val[1]
-		case "apn":
-			netIfConfig.AccessPointName = val[1]
-		}
-	}
+// LogFilter is a filter on one of maestro's log targets
+type LogFilter struct {
+	Target        string `json:"target"`
+	Levels        string `json:"levels"`
+	Tag           string `json:"tag"`
+	Pre           string `json:"format_pre"`
+	Post          string `json:"format_post"`
+	PostFmtPreMsg string `json:"format_post_pre_msg"`
+}
 
-	if netIfConfig.IfName == "" {
-		return "Missing IfName", errors.New("Missing IfName")
+// LogTarget is one of maestro's log targets and its filters
+type LogTarget struct {
+	Name    string      `json:"name"`
+	Filters []LogFilter `json:"filters"`
+}
 
+// SetLogFilter adds or changes a filter on a log target
+func (client *MaestroClient) SetLogFilter(filter LogFilter) error {
+	if filter.Target == "" {
+		return errors.New("Missing target")
 	}
+	return client.sendJSON(http.MethodPost, "/log/filter", &filter, nil)
+}
 
-	var configs = []maestroSpecs.NetIfConfigPayload{netIfConfig}
-	bytes, err := json.Marshal(configs)
-	if err != nil {
-		return "Failed to encode to JSON", err
+// DeleteLogFilter removes a filter from a log target
+func (client *MaestroClient) DeleteLogFilter(filter LogFilter) error {
+	if filter.Target == "" {
+		return errors.New("Missing target")
 	}
-
-	resp, err2 := self.put("/net/interfaces", bytes)
-
-	return resp.Status, err2
+	return client.sendJSON(http.MethodDelete, "/log/filter", &filter, nil)
 }
 
-func (self *MaestroClient) GetNetInterfaces() (out string, err error) {
-	resp, err := self.get("/net/interfaces")
-	var buf bytes.Buffer
-	if err == nil {
-		DebugOut("resp.Body = %+v", resp.Body)
-		body, err2 := ioutil.ReadAll(resp.Body)
-		DebugOut("resp.Body body = %+v", body)
-		DebugOut("resp.Body body = %s", string(body))
-		if err2 == nil {
-			buf.WriteString("interfaces:")
-			out, err = FormatJsonEasyRead(buf, body)
-			//			out = string()
-			//			json.Unmarshal(body, alive)
-		} else {
-			DebugOut("Error on ReadAll %s", err2.Error())
-			err = err2
-		}
-	}
+// GetLogTargets returns all log targets and their filters
+func (client *MaestroClient) GetLogTargets() (targets []LogTarget, err error) {
+	err = client.sendJSON(http.MethodGet, "/log/target", nil, &targets)
 	return
 }
 
@@ -463,102 +503,314 @@ type SubscribeNetEventsResponse struct {
 	Error string `json:"error"`
 }
 
+// NetEventHandler is called with the raw JSON of each batch of network
+// events maestro sends
+type NetEventHandler func(events []byte)
+
 // to be ran as a go routine
 func (client *MaestroClient) netEventListener() {
 	for {
-		if len(client.netEventsSubscribeID) < 1 {
+		// the subscription may be replaced while polling, such as by
+		// restoreSession, so each poll uses the latest one
+		client.stateLock.Lock()
+		id := client.netEventsSubscribeID
+		handler := client.netEventHandler
+		if len(id) < 1 {
+			client.netEventsListenerRunning = false
+			client.stateLock.Unlock()
 			DebugOut("network events listener stopping.")
-			break
+			return
 		}
-		resp, err := client.get(fmt.Sprintf("/net/events/%s", client.netEventsSubscribeID))
-		// var buf bytes.Buffer
+		client.stateLock.Unlock()
+
+		// a long poll, so no timeout, and not cancelled by CancelRequests()
+		uri := fmt.Sprintf("/net/events/%s", id)
+		resp, err := client.get(context.Background(), uri)
 		if err == nil {
-			DebugOut("resp.Body = %+v", resp.Body)
 			body, err2 := ioutil.ReadAll(resp.Body)
-			DebugOut("resp.Body body = %+v", body)
 			DebugOut("resp.Body body = %s", string(body))
-			if resp.StatusCode != 200 && resp.StatusCode != 204 {
-				Errorf("failed to get network events (%d): %s - Stopping listener.", resp.StatusCode, resp.Status)
-				client.netEventsSubscribeID = ""
-				break
-			} else {
-				if err2 == nil {
-					var buf bytes.Buffer
-					buf.WriteString("JSON:")
-					out, err := FormatJsonEasyRead(buf, body)
-					if err == nil {
-						EventOut("network", "%s", out)
-					} else {
-						Errorf("Could not parse network events: %s", err.Error())
-					}
+			resp.Body.Close()
+			if err3 := responseError(http.MethodGet, uri, resp, body); err3 != nil {
+				client.stateLock.Lock()
+				current := client.netEventsSubscribeID == id
+				if current {
+					client.netEventsSubscribeID = ""
+				}
+				client.stateLock.Unlock()
+				if current {
+					ErrorOut("failed to get network events: %s - Stopping listener.", errorString(err3))
 				} else {
-					DebugOut("Error on ReadAll %s", err2.Error())
-					err = err2
+					DebugOut("old network events subscription %s failed: %s", id, errorString(err3))
 				}
+			} else if err2 != nil {
+				DebugOut("Error on ReadAll %s", err2.Error())
+			} else if resp.StatusCode == 200 && handler != nil {
+				handler(body)
 			}
 		} else {
-			Errorf("Error polling net events: %s", err.Error())
+			// maestro may be restarting, don't spin
+			DebugOut("Error polling net events: %s", err.Error())
+			time.Sleep(minReconnectInterval)
 		}
 	}
-	client.netEventsListenerRunning = false
 }
 
-// SubscribeToNetEvents shell will subscribe to network events
-func (client *MaestroClient) SubscribeToNetEvents() (out string, err error) {
-	resp, err := client.get("/net/events")
-	// var buf bytes.Buffer
-	if err == nil {
-		DebugOut("resp.Body = %+v", resp.Body)
-		body, err2 := ioutil.ReadAll(resp.Body)
-		DebugOut("resp.Body body = %+v", body)
-		DebugOut("resp.Body body = %s", string(body))
-		if resp.StatusCode != 200 {
-			err = fmt.Errorf("failed to subscribe to network events (%d): %s", resp.StatusCode, resp.Status)
-		} else {
-			if err2 == nil {
-				evresp := &SubscribeNetEventsResponse{}
-				json.Unmarshal(body, evresp)
-				if len(evresp.Error) < 1 && len(evresp.ID) > 0 {
-					client.netEventsSubscribeID = evresp.ID
-					if !client.netEventsListenerRunning {
-						go client.netEventListener()
-					}
-				} else {
-					err = fmt.Errorf("failed to subscribe to network events: %s", evresp.Error)
+// SubscribeToNetEvents subscribes to network events. handler is called
+// from a go routine for every batch of events, until maestro drops the
+// subscription. The subscription is made again if maestro restarts.
+func (client *MaestroClient) SubscribeToNetEvents(handler NetEventHandler) (err error) {
+	var evresp SubscribeNetEventsResponse
+	if err = client.sendJSON(http.MethodGet, "/net/events", nil, &evresp); err != nil {
+		return
+	}
+	if len(evresp.Error) > 0 || len(evresp.ID) < 1 {
+		return fmt.Errorf("failed to subscribe to network events: %s", evresp.Error)
+	}
+	client.stateLock.Lock()
+	defer client.stateLock.Unlock()
+	client.netEventsSubscribeID = evresp.ID
+	client.netEventHandler = handler
+	client.netEventsWanted = true
+	if !client.netEventsListenerRunning {
+		client.netEventsListenerRunning = true
+		go client.netEventListener()
+	}
+	return
+}
+
+// jobs
+
+// JobStatus is the state maestro reports for a single job
+type JobStatus struct {
+	Job    string `json:"job"`
+	Status string `json:"status"`
+	Pid    int    `json:"pid"`
+}
+
+// IsStopped returns true if maestro no longer considers the job running
+func (status *JobStatus) IsStopped() bool {
+	return strings.EqualFold(status.Status, "stopped")
+}
+
+// GetJobStatuses returns the status of all jobs
+func (client *MaestroClient) GetJobStatuses() (statuses []JobStatus, err error) {
+	err = client.sendJSON(http.MethodGet, "/jobs", nil, &statuses)
+	return
+}
+
+// JobControlResult is the outcome of a start or stop request for a single job
+type JobControlResult struct {
+	Job string
+	Err error
+}
+
+func (client *MaestroClient) controlJob(name string, op string, body interface{}) (res JobControlResult) {
+	res.Job = name
+	res.Err = client.sendJSON(http.MethodPost, fmt.Sprintf("/jobs/%s/%s", url.PathEscape(name), op), body, nil)
+	return
+}
+
+// MaestroAPIError is returned when maestro answers a request with a non 2xx
+// status. Body is the response body, as maestro sent it.
+type MaestroAPIError struct {
+	StatusCode int
+	Method     string
+	URI        string
+	Body       []byte
+}
+
+// maestroErrorFields are the fields maestro may put its error message in
+var maestroErrorFields = []string{"error", "message", "msg", "reason", "details"}
+
+// Message returns maestro's error message, taken from the JSON body when
+// there is one, otherwise the body as text
+func (e *MaestroAPIError) Message() string {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(e.Body, &obj); err == nil {
+		for _, field := range maestroErrorFields {
+			switch val := obj[field].(type) {
+			case string:
+				if len(val) > 0 {
+					return val
+				}
+			case map[string]interface{}:
+				if msg, ok := val["message"].(string); ok && len(msg) > 0 {
+					return msg
 				}
-				// buf.WriteString("interfaces:")
-				// out, err = FormatJsonEasyRead(buf, body)
-				//			out = string()
-				//			json.Unmarshal(body, alive)
-			} else {
-				DebugOut("Error on ReadAll %s", err2.Error())
-				err = err2
 			}
-
 		}
 	}
+	var msg string
+	if err := json.Unmarshal(e.Body, &msg); err == nil {
+		return msg
+	}
+	return strings.TrimSpace(string(e.Body))
+}
+
+// Status is the status code with its text, such as "404 Not Found"
+func (e *MaestroAPIError) Status() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *MaestroAPIError) Error() string {
+	if msg := e.Message(); len(msg) > 0 {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.URI, e.Status(), msg)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URI, e.Status())
+}
+
+// responseError returns a *MaestroAPIError for a non 2xx response to
+// method uri, and nil otherwise
+func responseError(method string, uri string, resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	return &MaestroAPIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		URI:        uri,
+		Body:       body,
+	}
+}
+
+// StartJobs asks maestro to start each of the named jobs. A result is
+// returned for every job, in the order given.
+func (client *MaestroClient) StartJobs(names []string) (results []JobControlResult, err error) {
+	if len(names) < 1 {
+		err = errors.New("No job names given")
+		return
+	}
+	for _, name := range names {
+		results = append(results, client.controlJob(name, "start", nil))
+	}
 	return
 }
 
-// jobs
+// StopJobsOptions controls how maestro stops a job
+type StopJobsOptions struct {
+	// GracePeriod is how long maestro waits after asking the job to
+	// exit before killing it. Zero uses maestro's default.
+	GracePeriod time.Duration
+	// Force kills the job immediately, without a grace period
+	Force bool
+}
 
-func (client *MaestroClient) GetAllJobStatus() (out string, err error) {
-	resp, err := client.get("/jobs")
-	var buf bytes.Buffer
-	if err == nil {
-		DebugOut("resp.Body = %+v", resp.Body)
-		body, err2 := ioutil.ReadAll(resp.Body)
-		DebugOut("resp.Body body = %+v", body)
-		DebugOut("resp.Body body = %s", string(body))
-		if err2 == nil {
-			buf.WriteString("interfaces:")
-			out, err = FormatJsonEasyRead(buf, body)
-			//			out = string()
-			//			json.Unmarshal(body, alive)
-		} else {
-			DebugOut("Error on ReadAll %s", err2.Error())
+type stopJobRequest struct {
+	Force         bool  `json:"force"`
+	GracePeriodMs int64 `json:"grace_period_ms,omitempty"`
+}
+
+// StopJobs asks maestro to stop each of the named jobs. A result is
+// returned for every job, in the order given.
+func (client *MaestroClient) StopJobs(names []string, opts StopJobsOptions) (results []JobControlResult, err error) {
+	if len(names) < 1 {
+		err = errors.New("No job names given")
+		return
+	}
+	req := &stopJobRequest{
+		Force:         opts.Force,
+		GracePeriodMs: int64(opts.GracePeriod / time.Millisecond),
+	}
+	for _, name := range names {
+		results = append(results, client.controlJob(name, "stop", req))
+	}
+	return
+}
+
+const jobStatusPollInterval = 250 * time.Millisecond
+
+// WaitForJobStopped polls the job status until maestro reports the named
+// job as stopped, or the timeout expires. It returns how long the wait took.
+func (client *MaestroClient) WaitForJobStopped(name string, timeout time.Duration) (elapsed time.Duration, err error) {
+	start := time.Now()
+	for {
+		statuses, err2 := client.GetJobStatuses()
+		if err2 != nil {
 			err = err2
+			return
+		}
+		found := false
+		for i := range statuses {
+			if statuses[i].Job == name {
+				found = true
+				if statuses[i].IsStopped() {
+					elapsed = time.Since(start)
+					return
+				}
+			}
 		}
+		if !found {
+			err = fmt.Errorf("job %s not found", name)
+			return
+		}
+		if time.Since(start) >= timeout {
+			err = fmt.Errorf("timed out after %s waiting for %s to stop", timeout, name)
+			return
+		}
+		time.Sleep(jobStatusPollInterval)
+	}
+}
+
+// JobFieldError describes a problem with one field of a job definition
+type JobFieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *JobFieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
+
+// ValidateJobDefinition decodes a JSON job definition and checks it against
+// maestroSpecs.JobDefinitionPayload. Every field problem found is returned,
+// not just the first one.
+func ValidateJobDefinition(raw []byte) (job *maestroSpecs.JobDefinitionPayload, errs []error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid JSON: %s", err.Error()))
+		return
+	}
+
+	job = new(maestroSpecs.JobDefinitionPayload)
+	val := reflect.ValueOf(job).Elem()
+	known := map[string]int{}
+	for i := 0; i < val.NumField(); i++ {
+		tag := strings.Split(val.Type().Field(i).Tag.Get("json"), ",")[0]
+		if len(tag) > 0 {
+			known[tag] = i
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i, ok := known[name]
+		if !ok {
+			errs = append(errs, &JobFieldError{Field: name, Reason: "unknown field"})
+			continue
+		}
+		field := val.Field(i)
+		if err := json.Unmarshal(fields[name], field.Addr().Interface()); err != nil {
+			errs = append(errs, &JobFieldError{Field: name, Reason: fmt.Sprintf("expected %s", field.Type())})
+		}
+	}
+
+	if len(job.Job) < 1 {
+		errs = append(errs, &JobFieldError{Field: "job", Reason: "a job name is required"})
+	}
+	if len(job.ExecCmd) < 1 && len(job.ContainerTemplate) < 1 {
+		errs = append(errs, &JobFieldError{Field: "exec_cmd", Reason: "either exec_cmd or container_template is required"})
+	}
+	if job.WaitForOk && job.DeferRunningStatus > 0 {
+		errs = append(errs, &JobFieldError{Field: "defer_running_status", Reason: "can not be used with wait_for_ok"})
 	}
 	return
 }
+
+// RegisterJob defines a new job in maestro
+func (client *MaestroClient) RegisterJob(job *maestroSpecs.JobDefinitionPayload) error {
+	return client.sendJSON(http.MethodPost, "/jobs", job, nil)
+}
@@ -0,0 +1,416 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	prompt "github.com/c-bata/go-prompt"
+)
+
+// CompleteFunc suggests arguments for a command. args is the command line
+// up to the cursor, split the same way the command will see it.
+type CompleteFunc func(d prompt.Document, args []string) []prompt.Suggest
+
+// ArgSpec describes an argument or option a command accepts
+type ArgSpec struct {
+	// Name is what is completed, such as IfName for IfName=eth0, or --force
+	Name        string
+	Description string
+	// Values, if set, are suggested after Name=
+	Values []ArgSpec
+	// CompleteValue, if set, suggests values after Name= instead of Values.
+	// It is given the value typed so far.
+	CompleteValue func(value string) []prompt.Suggest
+	// Repeatable options are still suggested once they are on the line
+	Repeatable bool
+	// Secret options have their values kept out of the history and debug
+	// output, see redactSecrets
+	Secret bool
+}
+
+// boolValues are the values of a true or false option
+var boolValues = []ArgSpec{
+	{Name: "true"},
+	{Name: "false"},
+}
+
+// CommandSpec describes a command, and is all the shell needs to run,
+// complete and document it. A command with Subcommands is a group, which
+// runs the subcommand named by its next argument.
+type CommandSpec struct {
+	Name        string
+	Description string
+	// Notes are printed after the list of arguments or subcommands by help
+	Notes string
+	// Args are suggested when completing, unless Complete is set
+	Args []ArgSpec
+	// Run executes the command. args holds the whole command line, including
+	// the names of the command and any groups it is in.
+	Run Command
+	// Complete, if set, suggests arguments instead of Args
+	Complete CompleteFunc
+	// Table is set for getters which take --wide and --columns
+	Table bool
+	// Queryable commands return data which --query and | can work on.
+	// Table getters always do.
+	Queryable bool
+	// Hidden commands run, but are not suggested or listed by help
+	Hidden      bool
+	Subcommands []*CommandSpec
+}
+
+func (spec *CommandSpec) isGroup() bool {
+	return len(spec.Subcommands) > 0
+}
+
+func (spec *CommandSpec) isQueryable() bool {
+	return spec.Queryable || spec.Table
+}
+
+// subcommand returns the subcommand called name, or nil
+func (spec *CommandSpec) subcommand(name string) *CommandSpec {
+	return findSpec(spec.Subcommands, name)
+}
+
+func findSpec(specs []*CommandSpec, name string) *CommandSpec {
+	for _, s := range specs {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// addSpec adds spec to specs, replacing any spec with the same name
+func addSpec(specs []*CommandSpec, spec *CommandSpec) []*CommandSpec {
+	for i, s := range specs {
+		if s.Name == spec.Name {
+			specs[i] = spec
+			return specs
+		}
+	}
+	return append(specs, spec)
+}
+
+var rootCommands []*CommandSpec
+
+// RegisterCommand adds a top level command to the shell. A command with
+// the same name is replaced.
+func RegisterCommand(spec *CommandSpec) {
+	addGroupHelp(spec)
+	rootCommands = addSpec(rootCommands, spec)
+}
+
+// RegisterSubcommand adds spec to the group named by path, such as "net",
+// or "net dns" for a nested group. A subcommand with the same name is
+// replaced.
+func RegisterSubcommand(path string, spec *CommandSpec) error {
+	names := strings.Fields(path)
+	if len(names) < 1 {
+		return fmt.Errorf("Missing command group for %s", spec.Name)
+	}
+	group := findSpec(rootCommands, names[0])
+	for _, name := range names[1:] {
+		if group == nil {
+			break
+		}
+		group = group.subcommand(name)
+	}
+	if group == nil || !group.isGroup() {
+		return fmt.Errorf("No command group: %s", path)
+	}
+	addGroupHelp(spec)
+	group.Subcommands = addSpec(group.Subcommands, spec)
+	return nil
+}
+
+// addGroupHelp gives every group a hidden help subcommand
+func addGroupHelp(spec *CommandSpec) {
+	if !spec.isGroup() {
+		return
+	}
+	if spec.subcommand("help") == nil {
+		group := spec
+		spec.Subcommands = append(spec.Subcommands, &CommandSpec{
+			Name:   "help",
+			Hidden: true,
+			Run: func([]string) (string, error) {
+				return commandHelp(group), nil
+			},
+		})
+	}
+	for _, sub := range spec.Subcommands {
+		addGroupHelp(sub)
+	}
+}
+
+// findCommand walks args down the command tree. It returns the deepest
+// command found and how many of args name it.
+func findCommand(args []string) (spec *CommandSpec, n int) {
+	specs := rootCommands
+	for n < len(args) {
+		next := findSpec(specs, args[n])
+		if next == nil {
+			break
+		}
+		spec = next
+		specs = next.Subcommands
+		n++
+		if !next.isGroup() {
+			break
+		}
+	}
+	return
+}
+
+// runCommand dispatches an already split command line
+func runCommand(args []string) (out string, err error) {
+	spec, n := findCommand(args)
+	if spec == nil {
+		err = fmt.Errorf("no command: %s", args[0])
+		return
+	}
+	if spec.isGroup() {
+		name := strings.Join(args[:n], " ")
+		if n < len(args) {
+			err = fmt.Errorf("no command: %s %s", name, args[n])
+		} else {
+			err = fmt.Errorf("%s: not enough args", name)
+		}
+		return
+	}
+	return spec.Run(args)
+}
+
+// commandHelp lists a group's subcommands, or a command's arguments
+func commandHelp(spec *CommandSpec) string {
+	var buffer *bytes.Buffer
+	if spec.isGroup() {
+		buffer = bytes.NewBufferString(fmt.Sprintf("%s Subcommands:\n", strings.Title(spec.Name)))
+		// names are padded to line up, keeping a space before the -
+		width := 17
+		for _, sub := range spec.Subcommands {
+			if !sub.Hidden && len(sub.Name)+1 > width {
+				width = len(sub.Name) + 1
+			}
+		}
+		for _, sub := range spec.Subcommands {
+			if !sub.Hidden {
+				buffer.WriteString(fmt.Sprintf("%-*s- %s\n", width, sub.Name, sub.Description))
+			}
+		}
+	} else {
+		buffer = bytes.NewBufferString(fmt.Sprintf("%s - %s\n", spec.Name, spec.Description))
+		for _, arg := range spec.Args {
+			buffer.WriteString(fmt.Sprintf("  %-27s- %s\n", arg.Name, arg.Description))
+		}
+	}
+	buffer.WriteString("--\n")
+	buffer.WriteString(spec.Notes)
+	return strings.TrimRight(buffer.String(), "\n")
+}
+
+// cmdHelp lists the top level commands, or with arguments, the help for
+// the command they name
+func cmdHelp(args []string) (out string, err error) {
+	if len(args) > 1 {
+		spec, n := findCommand(args[1:])
+		if spec == nil || n < len(args)-1 {
+			err = fmt.Errorf("no command: %s", strings.Join(args[1:], " "))
+			return
+		}
+		out = commandHelp(spec)
+		return
+	}
+	buffer := bytes.NewBufferString("Commands:\n")
+	for _, cmd := range rootCommands {
+		if !cmd.Hidden {
+			buffer.WriteString(fmt.Sprintf("%-15s- %s\n", cmd.Name, cmd.Description))
+		}
+	}
+	buffer.WriteString("--\n")
+	buffer.WriteString("help <command> shows the subcommands or options of a command")
+	out = buffer.String()
+	return
+}
+
+// suggestCommands suggests the visible commands in specs
+func suggestCommands(specs []*CommandSpec) []prompt.Suggest {
+	suggests := make([]prompt.Suggest, 0, len(specs))
+	for _, s := range specs {
+		if !s.Hidden {
+			suggests = append(suggests, prompt.Suggest{Text: s.Name, Description: s.Description})
+		}
+	}
+	return suggests
+}
+
+func suggestArgs(args []ArgSpec) []prompt.Suggest {
+	suggests := make([]prompt.Suggest, 0, len(args))
+	for _, arg := range args {
+		suggests = append(suggests, prompt.Suggest{Text: arg.Name, Description: arg.Description})
+	}
+	return suggests
+}
+
+var tableArgs = []prompt.Suggest{
+	{Text: "--wide", Description: "Show all columns, without truncating"},
+	{Text: "--columns=", Description: "Comma separated list of columns to show"},
+}
+
+// completeCommand completes command names while they are being typed,
+// then hands over to the command's own argument completion
+func completeCommand(d prompt.Document, args []string) []prompt.Suggest {
+	specs := rootCommands
+	var spec *CommandSpec
+	for _, arg := range args[:len(args)-1] {
+		next := findSpec(specs, arg)
+		if next == nil {
+			return []prompt.Suggest{}
+		}
+		spec = next
+		if !spec.isGroup() {
+			break
+		}
+		specs = spec.Subcommands
+	}
+	last := args[len(args)-1]
+	if spec == nil || spec.isGroup() {
+		return prompt.FilterHasPrefix(suggestCommands(specs), last, true)
+	}
+	if spec.Table && strings.HasPrefix(last, "--") {
+		return prompt.FilterHasPrefix(tableArgs, last, true)
+	}
+	if spec.Complete != nil {
+		return spec.Complete(d, args)
+	}
+	return completeOptions(spec.Args, args)
+}
+
+// completeOptions completes key=value options. Before the = it suggests
+// the keys not already on the line, and after it the key's values. Keys
+// match ignoring case, as the commands parse them.
+func completeOptions(options []ArgSpec, args []string) []prompt.Suggest {
+	last := args[len(args)-1]
+	if eq := strings.Index(last, "="); eq >= 0 {
+		for _, opt := range options {
+			if !strings.EqualFold(opt.Name, last[:eq]) {
+				continue
+			}
+			var values []prompt.Suggest
+			if opt.CompleteValue != nil {
+				values = opt.CompleteValue(last[eq+1:])
+			} else {
+				values = suggestArgs(opt.Values)
+			}
+			return prompt.FilterHasPrefix(withPrefix(last[:eq+1], values), last, true)
+		}
+		return []prompt.Suggest{}
+	}
+
+	used := map[string]bool{}
+	for _, arg := range args[:len(args)-1] {
+		used[strings.ToLower(strings.SplitN(arg, "=", 2)[0])] = true
+	}
+	unused := make([]ArgSpec, 0, len(options))
+	for _, opt := range options {
+		if opt.Repeatable || !used[strings.ToLower(opt.Name)] {
+			unused = append(unused, opt)
+		}
+	}
+	return prompt.FilterHasPrefix(suggestArgs(unused), last, true)
+}
+
+var logFilterArgs = []ArgSpec{
+	{Name: "target", Description: "Log filter target"},
+	{Name: "levels", Description: "Log filter level"},
+	{Name: "tag", Description: "Log filter tag"},
+	{Name: "pre", Description: "Log pre filter"},
+	{Name: "post", Description: "Log post filter"},
+	{Name: "post-fmt-pre-msg", Description: "Log post format pre message"},
+}
+
+func init() {
+	RegisterCommand(&CommandSpec{Name: "exit", Description: "Exit shell", Run: cmdExit})
+	RegisterCommand(&CommandSpec{Name: "alive", Description: "Check if maestro is running & get up time", Run: cmdGetAlive, Queryable: true})
+	RegisterCommand(&CommandSpec{
+		Name:        "debug",
+		Description: "Turn on / off debug print outs",
+		Run:         cmdDebug,
+		Args: []ArgSpec{
+			{Name: "on", Description: "Turn on debugging"},
+			{Name: "off", Description: "Turn off debugging"},
+		},
+	})
+	RegisterCommand(&CommandSpec{
+		Name:        "net",
+		Description: "Query or change network interfaces",
+		Notes:       "Specify options as <opt>=<arg>, like IfName=eth0",
+		Subcommands: []*CommandSpec{
+			{Name: "get-interfaces", Description: "Show configurations for all interfaces", Run: netGetInterfaces, Table: true},
+			{Name: "events", Description: "Listen for network events", Run: netEvents},
+			{Name: "test-connectivity", Description: "Show maestro's last connectivity tests of an interface <ifname>", Run: netTestConnectivity, Table: true, Complete: completeInterfaceName},
+			{Name: "config-interface", Description: "Enter config for an interface", Run: netConfigInterface, Args: netIfConfigArgs},
+			{Name: "get-dns", Description: "Show all domain name servers", Run: dnsGet, Table: true},
+			{Name: "add-dns", Description: "Add a new domain name server", Run: dnsAdd, Args: []ArgSpec{
+				{Name: "<server>", Description: "Domain name server address"},
+			}},
+			{Name: "delete-dns", Description: "Delete an existing domain name server", Run: dnsDelete, Args: []ArgSpec{
+				{Name: "<server>", Description: "Domain name server address"},
+			}},
+		},
+	})
+	RegisterCommand(&CommandSpec{
+		Name:        "log",
+		Description: "Query or change logging parameters",
+		Notes:       "Specify options as <opt>=<arg>, like target=id",
+		Subcommands: []*CommandSpec{
+			{Name: "get", Description: "Show configurations for all logging targets", Run: logGet, Table: true},
+			{Name: "set", Description: "Set configurations for a logging target", Run: logSet, Args: logFilterArgs},
+			{Name: "delete", Description: "Delete a configuration for a logging target", Run: logDelete, Args: logFilterArgs},
+		},
+	})
+	RegisterCommand(&CommandSpec{
+		Name:        "jobs",
+		Description: "Query or change job configs",
+		Subcommands: []*CommandSpec{
+			{Name: "get", Description: "Show all running jobs.", Run: jobsGet, Table: true},
+			{Name: "stop", Description: "Stop one or more jobs by unique name", Run: jobsStop, Args: []ArgSpec{
+				{Name: "--force", Description: "Kill the job immediately"},
+				{Name: "--grace", Description: "Seconds to wait before killing the job"},
+				{Name: "--wait", Description: "Wait until the job is stopped [--wait=<timeout-seconds>]"},
+			}},
+			{Name: "start", Description: "Start one or more jobs by unique name", Run: jobsStart},
+			{Name: "register", Description: "Register (define) a new job using a JSON string", Run: jobsRegister, Complete: completeJobDefinition},
+		},
+	})
+	RegisterCommand(&CommandSpec{
+		Name:        "source",
+		Description: "Run commands from a file [--continue-on-error] <file>",
+		Run:         cmdSource,
+		Complete:    completeSource,
+	})
+	RegisterCommand(&CommandSpec{
+		Name:        "history",
+		Description: "List the commands run before, or run one again [number]",
+		Notes:       "Ctrl-R at the prompt finds the newest command containing what is typed",
+		Run:         cmdHistory,
+	})
+	RegisterCommand(&CommandSpec{Name: "help", Description: "Print available commands.", Run: cmdHelp, Complete: completeHelp})
+}
@@ -16,12 +16,13 @@ package shell
 // limitations under the License.
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"path/filepath"
 	"strings"
+	"time"
 
 	prompt "github.com/c-bata/go-prompt"
 )
@@ -33,83 +34,37 @@ const (
 
 var prompt_mode = prompt_mode_normal
 
-var commands = []prompt.Suggest{
-	{Text: "exit", Description: "Exit shell"},
-	{Text: "alive", Description: "Check if maestro is running & get up time"},
-	{Text: "debug", Description: "Turn on / off debug print outs"},
-	{Text: "net", Description: "Query or change network interfaces"},
-	{Text: "log", Description: "Query or change logging parameters"},
-	{Text: "jobs", Description: "Query or change job configs"},
-	{Text: "help", Description: "Print available commands."},
-}
-
-var logSubCommands = []prompt.Suggest{
-	{Text: "get", Description: "Show configurations for all logging targets"},
-	{Text: "set", Description: "Set configurations for a logging target"},
-	{Text: "delete", Description: "Delete a configuration for a logging target"},
-}
-
-var netSubcommands = []prompt.Suggest{
-	//{Text: "get-up-interfaces", Description: "Show configuration interfaces which are up."},
-	//{Text: "get-enabled-interfaces", Description: "Show configuration interfaces which are enabled."},
-	{Text: "get-interfaces", Description: "Show configurations for all interfaces"},
-	//{Text: "renew-dhcp", Description: "Renew DHCP lease for a specific interface"},
-	//{Text: "release-dhcp", Description: "Release DHCP lease for a specific interface"},
-	//{Text: "ifdown", Description: "Shutdown an interface"},
-	//{Text: "ifup", Description: "Bring up an interface"},
-	{Text: "events", Description: "Listen for network events [interval-seconds]"},
-	{Text: "config-interface", Description: "Enter config for an interface"},
-	{Text: "get-dns", Description: "Show all domain name servers"},
-	{Text: "add-dns", Description: "Add a new domain name server"},
-	{Text: "delete-dns", Description: "Delete an existing domain name server"},
-}
-
-func GetCommandsHelpString([]string) (ret string, err error) {
-	buffer := bytes.NewBufferString("Commands:\n")
-	for _, cmd := range commands {
-		buffer.WriteString(fmt.Sprintf("%-15s- %s\n", cmd.Text, cmd.Description))
-	}
-	buffer.WriteString("--\n")
-	ret = string(buffer.Bytes())
-	return
-}
-
-func GetNetSubcommandsHelpString([]string) (ret string, err error) {
-	buffer := bytes.NewBufferString("Net Subcommands:\n")
-	for _, cmd := range netSubcommands {
-		buffer.WriteString(fmt.Sprintf("%-17s- %s\n", cmd.Text, cmd.Description))
-	}
-	buffer.WriteString("--\n")
-	buffer.WriteString("Specify options as <opt>=<arg>, like IfName=eth0")
-	ret = string(buffer.Bytes())
-	return
-}
-
-func GetLogSubcommandsHelpString([]string) (ret string, err error) {
-	buffer := bytes.NewBufferString("Log Subcommands:\n")
-	for _, cmd := range logSubCommands {
-		buffer.WriteString(fmt.Sprintf("%-17s- %s\n", cmd.Text, cmd.Description))
-	}
-	buffer.WriteString("--\n")
-	buffer.WriteString("Specify options as <opt>=<arg>, like target=id")
-	ret = string(buffer.Bytes())
-	return
-}
-
 func Completer(d prompt.Document) []prompt.Suggest {
 	if d.TextBeforeCursor() == "" {
 		return []prompt.Suggest{}
 	}
-	args := strings.Split(d.TextBeforeCursor(), " ")
+	args := completionArgs(d.TextBeforeCursor())
 	//	w := d.GetWordBeforeCursor()
 
-	// If PIPE is in text before the cursor, returns empty suggestions.
+	// After a PIPE, only the built in filter stages can be used
 	for i := range args {
 		if args[i] == "|" {
+			if i == len(args)-2 {
+				filters := []prompt.Suggest{
+					{Text: "select", Description: "Pick out part of the output with a query, like '[].IfName'"},
+				}
+				return prompt.FilterHasPrefix(filters, args[len(args)-1], true)
+			}
 			return []prompt.Suggest{}
 		}
 	}
 
+	// --output and --query work with any command
+	if last := args[len(args)-1]; strings.HasPrefix(last, "--o") || strings.HasPrefix(last, "--q") {
+		output_args := []prompt.Suggest{
+			{Text: "--query=", Description: "Pick out part of the output, like '[].IfName'"},
+			{Text: "--output=pretty", Description: "Human readable output"},
+			{Text: "--output=json", Description: "Output maestro's response as JSON"},
+			{Text: "--output=yaml", Description: "Output maestro's response as YAML"},
+		}
+		return prompt.FilterHasPrefix(output_args, last, true)
+	}
+
 	// If word before the cursor starts with "-", returns CLI flag options.
 	// if strings.HasPrefix(w, "-") {
 	// 	return optionCompleter(args, strings.HasPrefix(w, "--"))
@@ -120,7 +75,39 @@ func Completer(d prompt.Document) []prompt.Suggest {
 	// 	return suggests
 	// }
 
-	return argumentsCompleter(args) // excludeOptions(args))
+	return completeCommand(d, args)
+}
+
+// completeJobDefinition completes the path of a JSON job definition, unless
+// the definition is given inline
+func completeJobDefinition(d prompt.Document, args []string) []prompt.Suggest {
+	if len(args) >= 3 && !strings.HasPrefix(args[2], "{") {
+		return fileCompleter(d, ".json")
+	}
+	return []prompt.Suggest{}
+}
+
+func completeSource(d prompt.Document, args []string) []prompt.Suggest {
+	if strings.HasPrefix(args[len(args)-1], "-") {
+		return prompt.FilterHasPrefix([]prompt.Suggest{
+			{Text: "--continue-on-error", Description: "Keep going after a command fails"},
+		}, args[len(args)-1], true)
+	}
+	return fileCompleter(d)
+}
+
+// completeHelp completes the names of the command to show help for
+func completeHelp(d prompt.Document, args []string) []prompt.Suggest {
+	names := args[1 : len(args)-1]
+	spec, n := findCommand(names)
+	if n < len(names) {
+		return []prompt.Suggest{}
+	}
+	specs := rootCommands
+	if spec != nil {
+		specs = spec.Subcommands
+	}
+	return prompt.FilterHasPrefix(suggestCommands(specs), args[len(args)-1], true)
 }
 
 func init() {
@@ -128,7 +115,7 @@ func init() {
 }
 
 func getPreviousOption(d prompt.Document) (cmd, option string, found bool) {
-	args := strings.Split(d.TextBeforeCursor(), " ")
+	args := completionArgs(d.TextBeforeCursor())
 	l := len(args)
 	if l >= 2 {
 		option = args[l-2]
@@ -160,8 +147,15 @@ func completeOptionArguments(d prompt.Document) ([]prompt.Suggest, bool) {
 
 var fileListCache map[string][]prompt.Suggest
 
-func fileCompleter(d prompt.Document) []prompt.Suggest {
-	path := d.GetWordBeforeCursor()
+// fileCompleter suggests directories and files ending in one of exts,
+// or all files if no exts are given
+func fileCompleter(d prompt.Document, exts ...string) []prompt.Suggest {
+	return fileSuggestions(d.GetWordBeforeCursor(), exts...)
+}
+
+// fileSuggestions suggests the directories and files, ending in one of
+// exts, which complete path
+func fileSuggestions(path string, exts ...string) []prompt.Suggest {
 	if strings.HasPrefix(path, "./") {
 		path = path[2:]
 	}
@@ -177,9 +171,7 @@ func fileCompleter(d prompt.Document) []prompt.Suggest {
 	}
 	suggests := make([]prompt.Suggest, 0, len(files))
 	for _, f := range files {
-		if !f.IsDir() &&
-			!strings.HasSuffix(f.Name(), ".yml") &&
-			!strings.HasSuffix(f.Name(), ".yaml") {
+		if !f.IsDir() && !hasAnySuffix(f.Name(), exts) {
 			continue
 		}
 		suggests = append(suggests, prompt.Suggest{Text: filepath.Join(dir, f.Name())})
@@ -187,460 +179,84 @@ func fileCompleter(d prompt.Document) []prompt.Suggest {
 	return prompt.FilterHasPrefix(suggests, path, false)
 }
 
-func argumentsCompleter(args []string) []prompt.Suggest {
-	if len(args) <= 1 {
-		return prompt.FilterHasPrefix(commands, args[0], true)
-	}
+/* interface names */
 
-	first := args[0]
-	second := args[1]
-	switch first {
-	case "net":
-		if len(args) == 2 {
-			return prompt.FilterHasPrefix(netSubcommands, second, true)
-		}
+// how long the interface names fetched from maestro are used for
+const interfaceListCacheTTL = 5 * time.Second
 
-		if len(args) >= 3 {
-			last := args[len(args)-1]
-			switch second {
-			case "add-dns", "delete-dns":
-				dns_set_args := []prompt.Suggest{
-					{Text: "<server>", Description: "Domain name server address"},
-				}
-				return prompt.FilterHasPrefix(dns_set_args, last, true)
-			case "config-interface":
-				iface_args := []prompt.Suggest{
-					{Text: "Type", Description: "Interface type, like wifi"},
-					{Text: "IfName", Description: "Interface name, like eth0"},
-					{Text: "DhcpV4Enabled", Description: "true or false"},
-					{Text: "IPv4Addr", Description: "IPv4 Address"},
-					{Text: "IPv4Mask", Description: "IPv4 Netmask integer (CIDR format)"},
-					{Text: "IPv4BCast", Description: "IPv4 Broadcast Address"},
-					//{Text: "AliasAddrV4", Description: "NOT IMPLEMENTED"},
-					{Text: "IPv6Addr", Description: "IPv6 Address"},
-					{Text: "HwAddr", Description: "MAC Address or similar"},
-					//{Text: "IEEE8021x", Description: "NOT IMPLEMENTED"},
-					{Text: "ReplaceAddress", Description: "Address to delete before setting the new address"},
-					{Text: "ClearAddresses", Description: "true or false.  if true, remove all existing addresses before setting the new address"},
-					{Text: "WifiSsid", Description: "Wifi SSID"},
-					{Text: "WifiPassword", Description: "Wifi Password"},
-					{Text: "Down", Description: "true or false.  if true, the interface is disabled"},
-					{Text: "DefaultGateway", Description: "Default route associated with this interface"},
-					//{Text: "FallbackDefaultGateway", Description: "NOT IMPLEMENTED"},
-					{Text: "RoutePriority", Description: "Interface priority as a default route, ranked across all interfaces.  range 0-9, 0=first priority, 9=last"},
-					{Text: "Aux", Description: "true or false"},
-					{Text: "NameserverOverrides", Description: "Override DNS"},
-					//{Text: "Routes", Description: "NOT IMPLEMENTED"},
-					//{Text: "TestHttpsRouteOut", Description: "NOT IMPLEMENTED"},
-					//{Text: "TestICMPv4EchoOut", Description: "NOT IMPLEMENTED"},
-					{Text: "DhcpDisableClearAddresses", Description: "Don't allow DHCP to clear all addresses"},
-					{Text: "DhcpStepTimeout", Description: "Max seconds to wait for DHCP address"},
-					{Text: "Existing", Description: "override=replace any data in the db, replace=remove any data in the db"},
-					{Text: "Type", Description: "Type of the connection, such as wifi or lte"},
-					{Text: "SerialDevice", Description: "Path to the LTE modem serial device"},
-					{Text: "APN", Description: "LTE modem access point name"},
-				}
-				return prompt.FilterHasPrefix(iface_args, last, true)
-			}
-		}
+// interfaceListTimeout bounds the request for interface names. Completion
+// runs while the user types, when Ctrl-C can not cancel a request, so a
+// slow maestro must not hold up typing for the client's full timeout.
+const interfaceListTimeout = 1 * time.Second
 
-	case "log":
-		if len(args) == 2 {
-			return prompt.FilterHasPrefix(logSubCommands, second, true)
-		}
+var interfaceListCache struct {
+	suggests []prompt.Suggest
+	fetched  time.Time
+}
 
-		if len(args) >= 3 {
-			last := args[len(args)-1]
-			switch second {
-			case "set", "delete":
-				log_set_args := []prompt.Suggest{
-					{Text: "target", Description: "Log filter target"},
-					{Text: "levels", Description: "Log filter level"},
-					{Text: "tag", Description: "Log filter tag"},
-					{Text: "pre", Description: "Log pre filter"},
-					{Text: "post", Description: "Log post filter"},
-					{Text: "post-fmt-pre-msg", Description: "Log post format pre message"},
-				}
-				return prompt.FilterHasPrefix(log_set_args, last, true)
-			}
+// interfaceSuggestions suggests the names of the interfaces maestro knows
+// about, with their current address as the description. The list is only
+// fetched again once it is a few seconds old, and not at all while maestro
+// is disconnected, so completion stays responsive.
+func interfaceSuggestions() []prompt.Suggest {
+	if time.Since(interfaceListCache.fetched) < interfaceListCacheTTL {
+		return interfaceListCache.suggests
+	}
+	if defaultClient == nil || !defaultClient.IsConnected() {
+		return []prompt.Suggest{}
+	}
+	// failures are cached too, so a broken maestro isn't asked on every key
+	interfaceListCache.fetched = time.Now()
+	interfaceListCache.suggests = []prompt.Suggest{}
+	ctx, cancel := context.WithTimeout(context.Background(), interfaceListTimeout)
+	defer cancel()
+	interfaces, err := defaultClient.GetNetInterfacesContext(ctx)
+	if err != nil {
+		DebugOut("could not get interfaces to complete: %s", err.Error())
+		return interfaceListCache.suggests
+	}
+	for _, iface := range interfaces {
+		if len(iface.IfName) == 0 {
+			continue
 		}
-
-	case "debug":
-		if len(args) == 2 {
-			subcommands := []prompt.Suggest{
-				{Text: "on", Description: "Turn on debugging"},
-				{Text: "off", Description: "Turn off debugging"},
-			}
-			return prompt.FilterHasPrefix(subcommands, second, true)
+		addr := "no address"
+		if len(iface.IPv4Addr) > 0 {
+			addr = fmt.Sprintf("%s/%d", iface.IPv4Addr, iface.IPv4Mask)
+		} else if iface.DhcpV4Enabled {
+			addr = "DHCP"
 		}
-	case "jobs":
-		if len(args) == 2 {
-			subcommands := []prompt.Suggest{
-				{Text: "get", Description: "Show all running jobs."},
-				{Text: "stop", Description: "Stop one or more jobs by unique name"},
-				{Text: "start", Description: "Start one or more jobs by unique name"},
-				{Text: "register", Description: "Register (define) a new job using a JSON string"},
-			}
-			return prompt.FilterHasPrefix(subcommands, second, true)
+		if len(iface.Type) > 0 {
+			addr = fmt.Sprintf("%s (%s)", addr, iface.Type)
 		}
-	case "get":
-	// 	second := args[1]
-	// 	if len(args) == 2 {
-	// 		subcommands := []prompt.Suggest{
-	// 			{Text: "componentstatuses"},
-	// 			{Text: "configmaps"},
-	// 			{Text: "daemonsets"},
-	// 			{Text: "deployments"},
-	// 			{Text: "endpoints"},
-	// 			{Text: "events"},
-	// 			{Text: "horizontalpodautoscalers"},
-	// 			{Text: "ingresses"},
-	// 			{Text: "jobs"},
-	// 			{Text: "limitranges"},
-	// 			{Text: "namespaces"},
-	// 			{Text: "networkpolicies"},
-	// 			{Text: "nodes"},
-	// 			{Text: "persistentvolumeclaims"},
-	// 			{Text: "persistentvolumes"},
-	// 			{Text: "pod"},
-	// 			{Text: "podsecuritypolicies"},
-	// 			{Text: "podtemplates"},
-	// 			{Text: "replicasets"},
-	// 			{Text: "replicationcontrollers"},
-	// 			{Text: "resourcequotas"},
-	// 			{Text: "secrets"},
-	// 			{Text: "serviceaccounts"},
-	// 			{Text: "services"},
-	// 			{Text: "statefulsets"},
-	// 			{Text: "storageclasses"},
-	// 			{Text: "thirdpartyresources"},
-	// 			// aliases
-	// 			{Text: "cs"},
-	// 			{Text: "cm"},
-	// 			{Text: "ds"},
-	// 			{Text: "deploy"},
-	// 			{Text: "ep"},
-	// 			{Text: "hpa"},
-	// 			{Text: "ing"},
-	// 			{Text: "limits"},
-	// 			{Text: "ns"},
-	// 			{Text: "no"},
-	// 			{Text: "pvc"},
-	// 			{Text: "pv"},
-	// 			{Text: "po"},
-	// 			{Text: "psp"},
-	// 			{Text: "rs"},
-	// 			{Text: "rc"},
-	// 			{Text: "quota"},
-	// 			{Text: "sa"},
-	// 			{Text: "svc"},
-	// 		}
-	// 		return prompt.FilterHasPrefix(subcommands, second, true)
-	// 	}
-
-	// 	third := args[2]
-	// 	if len(args) == 3 {
-	// 		switch second {
-	// 		case "componentstatuses", "cs":
-	// 			return prompt.FilterContains(getComponentStatusCompletions(), third, true)
-	// 		case "configmaps", "cm":
-	// 			return prompt.FilterContains(getConfigMapSuggestions(), third, true)
-	// 		case "daemonsets", "ds":
-	// 			return prompt.FilterContains(getDaemonSetSuggestions(), third, true)
-	// 		case "deploy", "deployments":
-	// 			return prompt.FilterContains(getDeploymentSuggestions(), third, true)
-	// 		case "endpoints", "ep":
-	// 			return prompt.FilterContains(getEndpointsSuggestions(), third, true)
-	// 		case "ingresses", "ing":
-	// 			return prompt.FilterContains(getIngressSuggestions(), third, true)
-	// 		case "limitranges", "limits":
-	// 			return prompt.FilterContains(getLimitRangeSuggestions(), third, true)
-	// 		case "namespaces", "ns":
-	// 			return prompt.FilterContains(getNameSpaceSuggestions(), third, true)
-	// 		case "no", "nodes":
-	// 			return prompt.FilterContains(getNodeSuggestions(), third, true)
-	// 		case "po", "pod", "pods":
-	// 			return prompt.FilterContains(getPodSuggestions(), third, true)
-	// 		case "persistentvolumeclaims", "pvc":
-	// 			return prompt.FilterContains(getPersistentVolumeClaimSuggestions(), third, true)
-	// 		case "persistentvolumes", "pv":
-	// 			return prompt.FilterContains(getPersistentVolumeSuggestions(), third, true)
-	// 		case "podsecuritypolicies", "psp":
-	// 			return prompt.FilterContains(getPodSecurityPolicySuggestions(), third, true)
-	// 		case "podtemplates":
-	// 			return prompt.FilterContains(getPodTemplateSuggestions(), third, true)
-	// 		case "replicasets", "rs":
-	// 			return prompt.FilterContains(getReplicaSetSuggestions(), third, true)
-	// 		case "replicationcontrollers", "rc":
-	// 			return prompt.FilterContains(getReplicationControllerSuggestions(), third, true)
-	// 		case "resourcequotas", "quota":
-	// 			return prompt.FilterContains(getResourceQuotasSuggestions(), third, true)
-	// 		case "secrets":
-	// 			return prompt.FilterContains(getSecretSuggestions(), third, true)
-	// 		case "sa", "serviceaccounts":
-	// 			return prompt.FilterContains(getServiceAccountSuggestions(), third, true)
-	// 		case "svc", "services":
-	// 			return prompt.FilterContains(getServiceSuggestions(), third, true)
-	// 		}
-	// 	}
-	// case "describe":
-	// 	second := args[1]
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(resourceTypes, second, true)
-	// 	}
-
-	// 	third := args[2]
-	// 	if len(args) == 3 {
-	// 		switch second {
-	// 		case "componentstatuses", "cs":
-	// 			return prompt.FilterContains(getComponentStatusCompletions(), third, true)
-	// 		case "configmaps", "cm":
-	// 			return prompt.FilterContains(getConfigMapSuggestions(), third, true)
-	// 		case "daemonsets", "ds":
-	// 			return prompt.FilterContains(getDaemonSetSuggestions(), third, true)
-	// 		case "deploy", "deployments":
-	// 			return prompt.FilterContains(getDeploymentSuggestions(), third, true)
-	// 		case "endpoints", "ep":
-	// 			return prompt.FilterContains(getEndpointsSuggestions(), third, true)
-	// 		case "ingresses", "ing":
-	// 			return prompt.FilterContains(getIngressSuggestions(), third, true)
-	// 		case "limitranges", "limits":
-	// 			return prompt.FilterContains(getLimitRangeSuggestions(), third, true)
-	// 		case "namespaces", "ns":
-	// 			return prompt.FilterContains(getNameSpaceSuggestions(), third, true)
-	// 		case "no", "nodes":
-	// 			return prompt.FilterContains(getNodeSuggestions(), third, true)
-	// 		case "po", "pod", "pods":
-	// 			return prompt.FilterContains(getPodSuggestions(), third, true)
-	// 		case "persistentvolumeclaims", "pvc":
-	// 			return prompt.FilterContains(getPersistentVolumeClaimSuggestions(), third, true)
-	// 		case "persistentvolumes", "pv":
-	// 			return prompt.FilterContains(getPersistentVolumeSuggestions(), third, true)
-	// 		case "podsecuritypolicies", "psp":
-	// 			return prompt.FilterContains(getPodSecurityPolicySuggestions(), third, true)
-	// 		case "podtemplates":
-	// 			return prompt.FilterContains(getPodTemplateSuggestions(), third, true)
-	// 		case "replicasets", "rs":
-	// 			return prompt.FilterContains(getReplicaSetSuggestions(), third, true)
-	// 		case "replicationcontrollers", "rc":
-	// 			return prompt.FilterContains(getReplicationControllerSuggestions(), third, true)
-	// 		case "resourcequotas", "quota":
-	// 			return prompt.FilterContains(getResourceQuotasSuggestions(), third, true)
-	// 		case "secrets":
-	// 			return prompt.FilterContains(getSecretSuggestions(), third, true)
-	// 		case "sa", "serviceaccounts":
-	// 			return prompt.FilterContains(getServiceAccountSuggestions(), third, true)
-	// 		case "svc", "services":
-	// 			return prompt.FilterContains(getServiceSuggestions(), third, true)
-	// 		}
-	// 	}
-	// case "create":
-	// 	subcommands := []prompt.Suggest{
-	// 		{Text: "configmap", Description: "Create a configmap from a local file, directory or literal value"},
-	// 		{Text: "deployment", Description: "Create a deployment with the specified name."},
-	// 		{Text: "namespace", Description: "Create a namespace with the specified name"},
-	// 		{Text: "quota", Description: "Create a quota with the specified name."},
-	// 		{Text: "secret", Description: "Create a secret using specified subcommand"},
-	// 		{Text: "service", Description: "Create a service using specified subcommand."},
-	// 		{Text: "serviceaccount", Description: "Create a service account with the specified name"},
-	// 	}
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(subcommands, args[1], true)
-	// 	}
-	// case "delete":
-	// 	second := args[1]
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(resourceTypes, second, true)
-	// 	}
+		interfaceListCache.suggests = append(interfaceListCache.suggests, prompt.Suggest{Text: iface.IfName, Description: addr})
+	}
+	return interfaceListCache.suggests
+}
 
-	// 	third := args[2]
-	// 	if len(args) == 3 {
-	// 		switch second {
-	// 		case "componentstatuses", "cs":
-	// 			return prompt.FilterContains(getComponentStatusCompletions(), third, true)
-	// 		case "configmaps", "cm":
-	// 			return prompt.FilterContains(getConfigMapSuggestions(), third, true)
-	// 		case "daemonsets", "ds":
-	// 			return prompt.FilterContains(getDaemonSetSuggestions(), third, true)
-	// 		case "deploy", "deployments":
-	// 			return prompt.FilterContains(getDeploymentSuggestions(), third, true)
-	// 		case "endpoints", "ep":
-	// 			return prompt.FilterContains(getEndpointsSuggestions(), third, true)
-	// 		case "ingresses", "ing":
-	// 			return prompt.FilterContains(getIngressSuggestions(), third, true)
-	// 		case "limitranges", "limits":
-	// 			return prompt.FilterContains(getLimitRangeSuggestions(), third, true)
-	// 		case "namespaces", "ns":
-	// 			return prompt.FilterContains(getNameSpaceSuggestions(), third, true)
-	// 		case "no", "nodes":
-	// 			return prompt.FilterContains(getNodeSuggestions(), third, true)
-	// 		case "po", "pod", "pods":
-	// 			return prompt.FilterContains(getPodSuggestions(), third, true)
-	// 		case "persistentvolumeclaims", "pvc":
-	// 			return prompt.FilterContains(getPersistentVolumeClaimSuggestions(), third, true)
-	// 		case "persistentvolumes", "pv":
-	// 			return prompt.FilterContains(getPersistentVolumeSuggestions(), third, true)
-	// 		case "podsecuritypolicies", "psp":
-	// 			return prompt.FilterContains(getPodSecurityPolicySuggestions(), third, true)
-	// 		case "podtemplates":
-	// 			return prompt.FilterContains(getPodTemplateSuggestions(), third, true)
-	// 		case "replicasets", "rs":
-	// 			return prompt.FilterContains(getReplicaSetSuggestions(), third, true)
-	// 		case "replicationcontrollers", "rc":
-	// 			return prompt.FilterContains(getReplicationControllerSuggestions(), third, true)
-	// 		case "resourcequotas", "quota":
-	// 			return prompt.FilterContains(getResourceQuotasSuggestions(), third, true)
-	// 		case "secrets":
-	// 			return prompt.FilterContains(getSecretSuggestions(), third, true)
-	// 		case "sa", "serviceaccounts":
-	// 			return prompt.FilterContains(getServiceAccountSuggestions(), third, true)
-	// 		case "svc", "services":
-	// 			return prompt.FilterContains(getServiceSuggestions(), third, true)
-	// 		}
-	// 	}
-	// case "edit":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(resourceTypes, args[1], true)
-	// 	}
+// completeInterfaceName completes the last argument as an interface name,
+// for commands which take one
+func completeInterfaceName(d prompt.Document, args []string) []prompt.Suggest {
+	return prompt.FilterHasPrefix(interfaceSuggestions(), args[len(args)-1], true)
+}
 
-	// 	if len(args) == 3 {
-	// 		third := args[2]
-	// 		switch args[1] {
-	// 		case "componentstatuses", "cs":
-	// 			return prompt.FilterContains(getComponentStatusCompletions(), third, true)
-	// 		case "configmaps", "cm":
-	// 			return prompt.FilterContains(getConfigMapSuggestions(), third, true)
-	// 		case "daemonsets", "ds":
-	// 			return prompt.FilterContains(getDaemonSetSuggestions(), third, true)
-	// 		case "deploy", "deployments":
-	// 			return prompt.FilterContains(getDeploymentSuggestions(), third, true)
-	// 		case "endpoints", "ep":
-	// 			return prompt.FilterContains(getEndpointsSuggestions(), third, true)
-	// 		case "ingresses", "ing":
-	// 			return prompt.FilterContains(getIngressSuggestions(), third, true)
-	// 		case "limitranges", "limits":
-	// 			return prompt.FilterContains(getLimitRangeSuggestions(), third, true)
-	// 		case "namespaces", "ns":
-	// 			return prompt.FilterContains(getNameSpaceSuggestions(), third, true)
-	// 		case "no", "nodes":
-	// 			return prompt.FilterContains(getNodeSuggestions(), third, true)
-	// 		case "po", "pod", "pods":
-	// 			return prompt.FilterContains(getPodSuggestions(), third, true)
-	// 		case "persistentvolumeclaims", "pvc":
-	// 			return prompt.FilterContains(getPersistentVolumeClaimSuggestions(), third, true)
-	// 		case "persistentvolumes", "pv":
-	// 			return prompt.FilterContains(getPersistentVolumeSuggestions(), third, true)
-	// 		case "podsecuritypolicies", "psp":
-	// 			return prompt.FilterContains(getPodSecurityPolicySuggestions(), third, true)
-	// 		case "podtemplates":
-	// 			return prompt.FilterContains(getPodTemplateSuggestions(), third, true)
-	// 		case "replicasets", "rs":
-	// 			return prompt.FilterContains(getReplicaSetSuggestions(), third, true)
-	// 		case "replicationcontrollers", "rc":
-	// 			return prompt.FilterContains(getReplicationControllerSuggestions(), third, true)
-	// 		case "resourcequotas", "quota":
-	// 			return prompt.FilterContains(getResourceQuotasSuggestions(), third, true)
-	// 		case "secrets":
-	// 			return prompt.FilterContains(getSecretSuggestions(), third, true)
-	// 		case "sa", "serviceaccounts":
-	// 			return prompt.FilterContains(getServiceAccountSuggestions(), third, true)
-	// 		case "svc", "services":
-	// 			return prompt.FilterContains(getServiceSuggestions(), third, true)
-	// 		}
-	// 	}
+// withPrefix returns suggests with prefix put in front of each one, for
+// completing the value of a key=value option
+func withPrefix(prefix string, suggests []prompt.Suggest) []prompt.Suggest {
+	ret := make([]prompt.Suggest, 0, len(suggests))
+	for _, s := range suggests {
+		ret = append(ret, prompt.Suggest{Text: prefix + s.Text, Description: s.Description})
+	}
+	return ret
+}
 
-	// case "namespace":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterContains(getNameSpaceSuggestions(), args[1], true)
-	// 	}
-	// case "logs":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterContains(getPodSuggestions(), args[1], true)
-	// 	}
-	// case "rolling-update", "rollingupdate":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterContains(getReplicationControllerSuggestions(), args[1], true)
-	// 	} else if len(args) == 3 {
-	// 		return prompt.FilterContains(getReplicationControllerSuggestions(), args[2], true)
-	// 	}
-	// case "scale", "resize":
-	// 	if len(args) == 2 {
-	// 		// Deployment, ReplicaSet, Replication Controller, or Job.
-	// 		r := getDeploymentSuggestions()
-	// 		r = append(r, getReplicaSetSuggestions()...)
-	// 		r = append(r, getReplicationControllerSuggestions()...)
-	// 		return prompt.FilterContains(r, args[1], true)
-	// 	}
-	// case "cordon":
-	// 	fallthrough
-	// case "drain":
-	// 	fallthrough
-	// case "uncordon":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(getNodeSuggestions(), args[1], true)
-	// 	}
-	// case "attach":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterContains(getPodSuggestions(), args[1], true)
-	// 	}
-	// case "exec":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterContains(getPodSuggestions(), args[1], true)
-	// 	}
-	// case "port-forward":
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterContains(getPodSuggestions(), args[1], true)
-	// 	}
-	// 	if len(args) == 3 {
-	// 		return prompt.FilterHasPrefix(getPortsFromPodName(args[1]), args[2], true)
-	// 	}
-	// case "rollout":
-	// 	subCommands := []prompt.Suggest{
-	// 		{Text: "history", Description: "view rollout history"},
-	// 		{Text: "pause", Description: "Mark the provided resource as paused"},
-	// 		{Text: "resume", Description: "Resume a paused resource"},
-	// 		{Text: "undo", Description: "undoes a previous rollout"},
-	// 	}
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(subCommands, args[1], true)
-	// 	}
-	// case "annotate":
-	// case "config":
-	// 	subCommands := []prompt.Suggest{
-	// 		{Text: "current-context", Description: "Displays the current-context"},
-	// 		{Text: "delete-cluster", Description: "Delete the specified cluster from the kubeconfig"},
-	// 		{Text: "delete-context", Description: "Delete the specified context from the kubeconfig"},
-	// 		{Text: "get-clusters", Description: "Display clusters defined in the kubeconfig"},
-	// 		{Text: "get-contexts", Description: "Describe one or many contexts"},
-	// 		{Text: "set", Description: "Sets an individual value in a kubeconfig file"},
-	// 		{Text: "set-cluster", Description: "Sets a cluster entry in kubeconfig"},
-	// 		{Text: "set-context", Description: "Sets a context entry in kubeconfig"},
-	// 		{Text: "set-credentials", Description: "Sets a user entry in kubeconfig"},
-	// 		{Text: "unset", Description: "Unsets an individual value in a kubeconfig file"},
-	// 		{Text: "use-context", Description: "Sets the current-context in a kubeconfig file"},
-	// 		{Text: "view", Description: "Display merged kubeconfig settings or a specified kubeconfig file"},
-	// 	}
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(subCommands, args[1], true)
-	// 	}
-	// 	if len(args) == 3 {
-	// 		third := args[2]
-	// 		switch args[1] {
-	// 		case "use-context":
-	// 			return prompt.FilterContains(getContextSuggestions(), third, true)
-	// 		}
-	// 	}
-	// case "cluster-info":
-	// 	subCommands := []prompt.Suggest{
-	// 		{Text: "dump", Description: "Dump lots of relevant info for debugging and diagnosis"},
-	// 	}
-	// 	if len(args) == 2 {
-	// 		return prompt.FilterHasPrefix(subCommands, args[1], true)
-	// 	}
-	// case "explain":
-	// 	return prompt.FilterHasPrefix(resourceTypes, args[1], true)
-	default:
-		return []prompt.Suggest{}
+func hasAnySuffix(name string, suffixes []string) bool {
+	if len(suffixes) == 0 {
+		return true
 	}
-	return []prompt.Suggest{}
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,173 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	aliveProbeTimeout    = 5 * time.Second
+	aliveCheckInterval   = 10 * time.Second
+	minReconnectInterval = 1 * time.Second
+	maxReconnectInterval = 30 * time.Second
+)
+
+// IsConnected returns true if the last request to maestro got a response
+func (client *MaestroClient) IsConnected() bool {
+	client.stateLock.Lock()
+	defer client.stateLock.Unlock()
+	return client.connected
+}
+
+// LastConnectError is the error from the last request which failed to reach
+// maestro, if the client is disconnected
+func (client *MaestroClient) LastConnectError() error {
+	client.stateLock.Lock()
+	defer client.stateLock.Unlock()
+	if client.connected {
+		return nil
+	}
+	return client.lastConnectErr
+}
+
+// setConnected records whether maestro could be reached
+func (client *MaestroClient) setConnected(connected bool, err error) {
+	client.stateLock.Lock()
+	defer client.stateLock.Unlock()
+	client.connected = connected
+	client.lastConnectErr = err
+}
+
+// probe checks /alive, updating the connection state. Unlike GetAlive it is
+// not cancelled by CancelRequests(), and uses a short timeout of its own.
+func (client *MaestroClient) probe() (alive *AliveResponse, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), aliveProbeTimeout)
+	defer cancel()
+	resp, err := client.do(ctx, http.MethodGet, "/alive", nil)
+	if err != nil {
+		client.setConnected(false, err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		alive, err = decodeAlive(resp, body)
+	}
+	if err != nil {
+		// something answered, but it is not maestro
+		client.setConnected(false, err)
+	}
+	return
+}
+
+func decodeAlive(resp *http.Response, body []byte) (alive *AliveResponse, err error) {
+	if err = responseError(http.MethodGet, "/alive", resp, body); err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("/alive returned %s", resp.Status)
+		return
+	}
+	alive = &AliveResponse{}
+	if err = json.Unmarshal(body, alive); err != nil {
+		alive = nil
+		err = fmt.Errorf("/alive returned an unexpected response: %s", err.Error())
+	}
+	return
+}
+
+// StartReconnectLoop checks maestro is still alive in the background. When
+// it can't be reached, it retries with a growing backoff, and once it is
+// back, the session is re-established by subscribing to network events
+// again if they were being listened to.
+func (client *MaestroClient) StartReconnectLoop() {
+	client.stateLock.Lock()
+	if client.reconnectRunning {
+		client.stateLock.Unlock()
+		return
+	}
+	client.reconnectRunning = true
+	client.stateLock.Unlock()
+	go client.reconnectLoop()
+}
+
+func (client *MaestroClient) reconnectLoop() {
+	backoff := minReconnectInterval
+	var lastUptime int64
+	wasConnected := client.IsConnected()
+	for {
+		if wasConnected {
+			time.Sleep(aliveCheckInterval)
+		} else {
+			time.Sleep(backoff)
+		}
+
+		alive, err := client.probe()
+		if err != nil {
+			if wasConnected {
+				EventOut("connection", "lost connection to maestro: %s", err.Error())
+			} else {
+				DebugOut("reconnect failed, retrying in %s: %s", backoff, err.Error())
+				backoff *= 2
+				if backoff > maxReconnectInterval {
+					backoff = maxReconnectInterval
+				}
+			}
+			wasConnected = false
+			continue
+		}
+
+		restarted := alive.Uptime < lastUptime
+		lastUptime = alive.Uptime
+		if !wasConnected || restarted {
+			if !wasConnected {
+				EventOut("connection", "connected to maestro")
+			} else {
+				EventOut("connection", "maestro restarted")
+			}
+			client.restoreSession()
+		}
+		wasConnected = true
+		backoff = minReconnectInterval
+	}
+}
+
+// restoreSession sets up again anything maestro forgets when it restarts
+func (client *MaestroClient) restoreSession() {
+	client.stateLock.Lock()
+	wanted := client.netEventsWanted
+	handler := client.netEventHandler
+	client.stateLock.Unlock()
+	if wanted {
+		if err := client.SubscribeToNetEvents(handler); err != nil {
+			ErrorOut("could not subscribe to network events again: %s", errorString(err))
+		}
+	}
+}
+
+// LivePrefix is the prompt prefix, showing whether maestro is connected
+func LivePrefix() (prefix string, useLivePrefix bool) {
+	if defaultClient == nil || !defaultClient.IsConnected() {
+		return "maestro (disconnected)> ", true
+	}
+	return "maestro> ", true
+}
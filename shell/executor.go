@@ -16,10 +16,15 @@ package shell
 // limitations under the License.
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ConsoleOut Dump to console
@@ -46,7 +51,40 @@ func Errorf(format string, a ...interface{}) string {
 
 func ErrorOut(format string, a ...interface{}) {
 	s := Errorf(format, a...)
-	ConsoleOut("%s", s)
+	fmt.Fprintf(errorOutput, "> %s\n", s)
+}
+
+// errorOutput is where errors are printed. Outside the interactive shell,
+// that is stderr, so they don't mix with output another program parses.
+var errorOutput io.Writer = os.Stderr
+
+// SetInteractive is called when the shell runs at a prompt, where errors
+// are printed along with everything else
+func SetInteractive(interactive bool) {
+	if interactive {
+		errorOutput = os.Stdout
+	} else {
+		errorOutput = os.Stderr
+	}
+}
+
+// printError prints a command's error to errorOutput
+func printError(err error) {
+	fmt.Fprintln(errorOutput, Errorf("%s", errorString(err)))
+}
+
+// errorString renders err for the user. An error maestro returned is shown
+// as maestro's own message, followed by the status and the request, so it
+// reads differently from an error in the shell itself.
+func errorString(err error) string {
+	var apiErr *MaestroAPIError
+	if errors.As(err, &apiErr) {
+		if msg := apiErr.Message(); len(msg) > 0 {
+			return fmt.Sprintf("maestro: %s (%s from %s %s)", msg, apiErr.Status(), apiErr.Method, apiErr.URI)
+		}
+		return fmt.Sprintf("maestro: %s from %s %s", apiErr.Status(), apiErr.Method, apiErr.URI)
+	}
+	return err.Error()
 }
 
 // Eventf prints events to user
@@ -77,12 +115,10 @@ func cmdExit(args []string) (out string, err error) {
 }
 
 var errors_no_client error
-var errors_not_implemented error
 var debug_on bool
 
 func init() {
 	errors_no_client = errors.New("Maestro could not connect.")
-	errors_not_implemented = errors.New("Not implemented yet")
 	debug_on = false
 }
 
@@ -90,10 +126,18 @@ func cmdGetAlive(args []string) (out string, err error) {
 	if defaultClient != nil {
 		res, err2 := defaultClient.GetAlive()
 		DebugOut("getAlive:%+v %+v", res, err2)
-		if err2 == nil {
-			out = Successf("Maestro Up. Uptime = %d.%ds\n", res.Uptime/1000000000, res.Uptime%1000000000)
-		} else {
+		if err2 != nil {
 			err = err2
+		} else if outputMode != OutputPretty {
+			// for tools parsing the output, the response itself
+			b, err3 := json.Marshal(res)
+			if err3 == nil {
+				out, err = formatOutput("", b)
+			} else {
+				err = err3
+			}
+		} else {
+			out = Successf("Maestro Up. Uptime = %d.%ds\n", res.Uptime/1000000000, res.Uptime%1000000000)
 		}
 	} else {
 		err = errors_no_client
@@ -119,52 +163,46 @@ func cmdDebug(args []string) (out string, err error) {
 	return
 }
 
-func cmdNet(args []string) (out string, err error) {
-	if len(args) > 1 {
-		cmd, ok := netCommands[args[1]]
-		if ok {
-			out, err := cmd(args)
-			if err != nil {
-				//			DebugOut("here1")
-				fmt.Println(Errorf("%s", err.Error()))
-			} else {
-				//			DebugOut("here")
-				fmt.Println(out)
-			}
-		} else {
-			fmt.Printf("%s\n", Errorf("no command: net %s", args[1]))
+func netConfigInterface(args []string) (out string, err error) {
+	if defaultClient != nil {
+		config, auth, err2 := parseNetIfConfig(args)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		err = defaultClient.ConfigNetInterfaceWithAuth(config, auth)
+		// the config is not shown, as it may hold passwords
+		DebugOut("net ConfigInterface:%s %+v", config.IfName, err)
+		if err == nil {
+			out = Successf("%s: configured", config.IfName)
 		}
 	} else {
-		fmt.Printf("%s\n", Errorf("net: not enough args"))
+		err = errors_no_client
 	}
 	return
 }
 
-func cmdJobs(args []string) (out string, err error) {
-	if len(args) > 1 {
-		cmd, ok := jobsCommands[args[1]]
-		if ok {
-			out, err := cmd(args)
-			if err != nil {
-				//			DebugOut("here1")
-				fmt.Println(Errorf("%s", err.Error()))
-			} else {
-				//			DebugOut("here")
-				fmt.Println(out)
-			}
-		} else {
-			fmt.Printf("%s\n", Errorf("no command: jobs %s", args[1]))
+func dnsAdd(args []string) (out string, err error) {
+	if defaultClient != nil {
+		if len(args) < 3 {
+			err = errors.New("Usage: net add-dns <nameserver>")
+			return
+		}
+		err = defaultClient.AddDNS(args[2])
+		DebugOut("dns add:%s %+v", args[2], err)
+		if err == nil {
+			out = Successf("%s: added", args[2])
 		}
 	} else {
-		fmt.Printf("%s\n", Errorf("jobs: not enough args"))
+		err = errors_no_client
 	}
 	return
 }
 
-func netConfigInterface(args []string) (out string, err error) {
+func dnsGet(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.ConfigNetInterface(args)
-		DebugOut("net ConfigInterface:%+v %+v", res, err2)
+		res, err2 := getTable(args, 0, "/net/dns", "nameservers:", dnsColumns, dnsRecords)
+		DebugOut("dns get:%+v %+v", res, err2)
 		if err2 == nil {
 			out = Successf("%v", res)
 		} else {
@@ -176,10 +214,56 @@ func netConfigInterface(args []string) (out string, err error) {
 	return
 }
 
-func dnsAdd(args []string) (out string, err error) {
+func dnsDelete(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.AddDNS(args)
-		DebugOut("dns add:%+v %+v", res, err2)
+		if len(args) < 3 {
+			err = errors.New("Usage: net delete-dns <nameserver>")
+			return
+		}
+		err = defaultClient.DeleteDNS(args[2])
+		DebugOut("dns delete:%s %+v", args[2], err)
+		if err == nil {
+			out = Successf("%s: deleted", args[2])
+		}
+	} else {
+		err = errors_no_client
+	}
+	return
+}
+
+// getTable renders the response from uri as a table when the output mode
+// is pretty, otherwise as the raw response in the output mode, under title.
+// params is how many arguments the command takes after its name.
+func getTable(args []string, params int, uri string, title string, columns []tableColumn, records func([]byte) ([]map[string]interface{}, error)) (out string, err error) {
+	rest, opts, err := extractTableFlags(args)
+	if err != nil {
+		return
+	}
+	// anything left beyond the command and its params is a mistake, such
+	// as a misspelt flag
+	if _, n := findCommand(rest); len(rest) > n+params {
+		err = fmt.Errorf("Unexpected argument %s. Usage: %s [--wide] [--columns=<header,...>]", rest[n+params], strings.Join(rest[:n], " "))
+		return
+	}
+	body, err := defaultClient.getBody(uri)
+	if err != nil {
+		return
+	}
+	if outputMode != OutputPretty {
+		return formatOutput(title, body)
+	}
+	recs, err := records(body)
+	if err != nil {
+		return
+	}
+	out, err = renderTable(columns, recs, opts)
+	return
+}
+
+func netGetInterfaces(args []string) (out string, err error) {
+	if defaultClient != nil {
+		res, err2 := getTable(args, 0, "/net/interfaces", "interfaces:", interfaceColumns, decodeRecords)
+		DebugOut("net getInterfaces:%+v %+v", res, err2)
 		if err2 == nil {
 			out = Successf("%v", res)
 		} else {
@@ -191,10 +275,19 @@ func dnsAdd(args []string) (out string, err error) {
 	return
 }
 
-func dnsGet(args []string) (out string, err error) {
+func netTestConnectivity(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.GetDNS()
-		DebugOut("dns get:%+v %+v", res, err2)
+		rest, _, err2 := extractTableFlags(args)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		if len(rest) != 3 {
+			err = errors.New("Usage: net test-connectivity <ifname>")
+			return
+		}
+		res, err2 := getTable(args, 1, connectivityURI(rest[2]), "connectivity:", connectivityColumns, decodeRecords)
+		DebugOut("net testConnectivity:%+v %+v", res, err2)
 		if err2 == nil {
 			out = Successf("%v", res)
 		} else {
@@ -206,10 +299,33 @@ func dnsGet(args []string) (out string, err error) {
 	return
 }
 
-func dnsDelete(args []string) (out string, err error) {
+func netEvents(args []string) (out string, err error) {
+	if defaultClient != nil {
+		err = defaultClient.SubscribeToNetEvents(printNetEvents)
+		DebugOut("net SubscribeToNetEvents: %+v", err)
+		if err == nil {
+			out = Successf("Subscribed to network events")
+		}
+	} else {
+		err = errors_no_client
+	}
+	return
+}
+
+// printNetEvents shows each batch of network events as they arrive
+func printNetEvents(events []byte) {
+	out, err := formatOutput("JSON:", events)
+	if err == nil {
+		EventOut("network", "%s", out)
+	} else {
+		ErrorOut("Could not parse network events: %s", err.Error())
+	}
+}
+
+func jobsGet(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.DeleteDNS(args)
-		DebugOut("dns delete:%+v %+v", res, err2)
+		res, err2 := getTable(args, 0, "/jobs", "jobs:", jobColumns, decodeRecords)
+		DebugOut("net JobsGetAll:%+v %+v", res, err2)
 		if err2 == nil {
 			out = Successf("%v", res)
 		} else {
@@ -221,14 +337,31 @@ func dnsDelete(args []string) (out string, err error) {
 	return
 }
 
-func netGetInterfaces(args []string) (out string, err error) {
+func jobsStart(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.GetNetInterfaces()
-		DebugOut("net getInterfaces:%+v %+v", res, err2)
-		if err2 == nil {
-			out = Successf("%v", res)
-		} else {
+		if len(args) < 3 {
+			err = errors.New("Usage: jobs start <job name> [job name...]")
+			return
+		}
+		results, err2 := defaultClient.StartJobs(args[2:])
+		DebugOut("jobs start:%+v %+v", results, err2)
+		if err2 != nil {
 			err = err2
+			return
+		}
+		var lines []string
+		failed := 0
+		for _, res := range results {
+			if res.Err != nil {
+				failed++
+				lines = append(lines, Errorf("%s: %s", res.Job, errorString(res.Err)))
+			} else {
+				lines = append(lines, Successf("%s: started", res.Job))
+			}
+		}
+		out = strings.Join(lines, "\n")
+		if failed > 0 {
+			err = fmt.Errorf("%d of %d jobs failed to start", failed, len(results))
 		}
 	} else {
 		err = errors_no_client
@@ -236,14 +369,85 @@ func netGetInterfaces(args []string) (out string, err error) {
 	return
 }
 
-func netEvents(args []string) (out string, err error) {
+const defaultJobStopWaitSeconds = 30
+
+func jobsStop(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.SubscribeToNetEvents()
-		DebugOut("net SubscribeToNetEvents: %+v %+v", res, err2)
-		if err2 == nil {
-			out = Successf("%v", res)
-		} else {
+		var opts StopJobsOptions
+		var names []string
+		wait := false
+		waitTimeout := time.Duration(defaultJobStopWaitSeconds) * time.Second
+		for i := 2; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "--force":
+				opts.Force = true
+			case arg == "--grace":
+				if i+1 >= len(args) {
+					err = errors.New("--grace needs a number of seconds")
+					return
+				}
+				i++
+				secs, err2 := strconv.Atoi(args[i])
+				if err2 != nil || secs < 0 {
+					err = fmt.Errorf("Invalid grace period: %s", args[i])
+					return
+				}
+				opts.GracePeriod = time.Duration(secs) * time.Second
+			case arg == "--wait":
+				wait = true
+			case strings.HasPrefix(arg, "--wait="):
+				wait = true
+				secs, err2 := strconv.Atoi(strings.TrimPrefix(arg, "--wait="))
+				if err2 != nil || secs <= 0 {
+					err = fmt.Errorf("Invalid wait timeout: %s", arg)
+					return
+				}
+				waitTimeout = time.Duration(secs) * time.Second
+			case strings.HasPrefix(arg, "--"):
+				err = fmt.Errorf("Unknown option: %s", arg)
+				return
+			default:
+				names = append(names, arg)
+			}
+		}
+		if len(names) < 1 {
+			err = errors.New("Usage: jobs stop [--force] [--grace <seconds>] [--wait[=<seconds>]] <job name> [job name...]")
+			return
+		}
+		if opts.Force && opts.GracePeriod > 0 {
+			err = errors.New("--force and --grace can not be used together")
+			return
+		}
+		results, err2 := defaultClient.StopJobs(names, opts)
+		DebugOut("jobs stop:%+v %+v", results, err2)
+		if err2 != nil {
 			err = err2
+			return
+		}
+		var lines []string
+		failed := 0
+		for _, res := range results {
+			if res.Err != nil {
+				failed++
+				lines = append(lines, Errorf("%s: %s", res.Job, errorString(res.Err)))
+				continue
+			}
+			if !wait {
+				lines = append(lines, Successf("%s: stop requested", res.Job))
+				continue
+			}
+			elapsed, err2 := defaultClient.WaitForJobStopped(res.Job, waitTimeout)
+			if err2 != nil {
+				failed++
+				lines = append(lines, Errorf("%s: %s", res.Job, errorString(err2)))
+			} else {
+				lines = append(lines, Successf("%s: stopped in %s", res.Job, elapsed.Round(time.Millisecond)))
+			}
+		}
+		out = strings.Join(lines, "\n")
+		if failed > 0 {
+			err = fmt.Errorf("%d of %d jobs failed to stop", failed, len(results))
 		}
 	} else {
 		err = errors_no_client
@@ -251,10 +455,87 @@ func netEvents(args []string) (out string, err error) {
 	return
 }
 
-func jobsGet(args []string) (out string, err error) {
+func jobsRegister(args []string) (out string, err error) {
 	if defaultClient != nil {
-		res, err2 := defaultClient.GetAllJobStatus()
-		DebugOut("net JobsGetAll:%+v %+v", res, err2)
+		if len(args) < 3 {
+			err = errors.New("Usage: jobs register '<JSON job definition>' | <path to .json file>")
+			return
+		}
+		var raw []byte
+		def := strings.TrimSpace(strings.Join(args[2:], " "))
+		if strings.HasPrefix(def, "{") {
+			raw = []byte(def)
+		} else {
+			raw, err = ioutil.ReadFile(def)
+			if err != nil {
+				return
+			}
+		}
+		job, errs := ValidateJobDefinition(raw)
+		if len(errs) > 0 {
+			lines := make([]string, 0, len(errs))
+			for _, e := range errs {
+				lines = append(lines, "  "+e.Error())
+			}
+			err = fmt.Errorf("Invalid job definition:\n%s", strings.Join(lines, "\n"))
+			return
+		}
+		err = defaultClient.RegisterJob(job)
+		DebugOut("jobs register:%+v", err)
+		if err == nil {
+			out = Successf("%s: registered", job.Job)
+		}
+	} else {
+		err = errors_no_client
+	}
+	return
+}
+
+// parseLogFilter builds a log filter from the key=value options of
+// "log set" and "log delete"
+func parseLogFilter(args []string) (filter LogFilter, err error) {
+	// check for addition args beyond "log set"
+	if len(args)-2 <= 0 {
+		err = errors.New("Missing log filter options")
+		return
+	}
+
+	for _, opt := range args[2:] {
+		val := strings.SplitN(opt, "=", 2)
+		if len(val) < 2 {
+			err = fmt.Errorf("Invalid option: %s", opt)
+			return
+		}
+		DebugOut("opt=%s, arg=%s", val[0], val[1])
+		switch strings.ToLower(val[0]) {
+		case "target":
+			filter.Target = val[1]
+		case "levels":
+			filter.Levels = val[1]
+		case "tag":
+			filter.Tag = val[1]
+		case "pre":
+			filter.Pre = val[1]
+		case "post":
+			filter.Post = val[1]
+		case "post-fmt-pre-msg":
+			filter.PostFmtPreMsg = val[1]
+		default:
+			err = fmt.Errorf("Unknown option: %s", val[0])
+			return
+		}
+	}
+
+	if filter.Target == "" {
+		err = errors.New("Missing target")
+	}
+	return
+}
+
+func logGet(args []string) (out string, err error) {
+	if defaultClient != nil {
+		res, err2 := getTable(args, 0, "/log/target", "targets:", logFilterColumns, logTargetRecords)
+		DebugOut("log get:%+v %+v", res, err2)
 		if err2 == nil {
 			out = Successf("%v", res)
 		} else {
@@ -266,60 +547,105 @@ func jobsGet(args []string) (out string, err error) {
 	return
 }
 
-func notImplemented(args []string) (out string, err error) {
+func logSet(args []string) (out string, err error) {
 	if defaultClient != nil {
-		err = errors_not_implemented
-		//		fmt.Printf("%s\n", Errorf("Not implemented yet: ", args[1]))
+		filter, err2 := parseLogFilter(args)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		err = defaultClient.SetLogFilter(filter)
+		DebugOut("log set:%+v %+v", filter, err)
+		if err == nil {
+			out = Successf("%s: filter set", filter.Target)
+		}
 	} else {
 		err = errors_no_client
 	}
 	return
 }
 
-var commandMap = map[string]Command{
-	"exit":  cmdExit,
-	"alive": cmdGetAlive,
-	"net":   cmdNet,
-	"jobs":  cmdJobs,
-	"debug": cmdDebug,
-	"help":  GetCommandsHelpString,
+func logDelete(args []string) (out string, err error) {
+	if defaultClient != nil {
+		filter, err2 := parseLogFilter(args)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		err = defaultClient.DeleteLogFilter(filter)
+		DebugOut("log delete:%+v %+v", filter, err)
+		if err == nil {
+			out = Successf("%s: filter deleted", filter.Target)
+		}
+	} else {
+		err = errors_no_client
+	}
+	return
+}
+
+// runArgs runs a single, already split, command, with any --output and
+// --query flags and | stages it has
+func runArgs(argz []string) (out string, err error) {
+	argz, mode, err := extractOutputFlag(argz)
+	if err != nil {
+		return
+	}
+	if len(mode) > 0 {
+		defer SetOutputMode(outputMode)
+		outputMode = mode
+	}
+	var expr string
+	argz, expr, err = extractQueryFlag(argz)
+	if err == nil && len(argz) > 0 {
+		stages := splitPipeline(argz)
+		if len(stages) > 1 || len(expr) > 0 {
+			out, err = runPipeline(stages, expr)
+		} else {
+			out, err = runCommand(argz)
+		}
+	}
+	return
 }
 
-var netCommands = map[string]Command{
-	"get-interfaces":   netGetInterfaces,
-	"events":           netEvents,
-	"config-interface": netConfigInterface,
-	"get-dns":          dnsGet,
-	"add-dns":          dnsAdd,
-	"delete-dns":       dnsDelete,
-	"help":             GetNetSubcommandsHelpString,
+// ExecuteArgs runs a single, already split, command. Any output is printed,
+// and the command's error, if any, is printed and returned.
+func ExecuteArgs(argz []string) (err error) {
+	if len(argz) < 1 {
+		return
+	}
+	out, err := runArgs(argz)
+	if len(out) > 0 {
+		fmt.Println(out)
+	}
+	if _, ok := err.(reportedError); err != nil && !ok {
+		printError(err)
+	}
+	return
 }
 
-var jobsCommands = map[string]Command{
-	"get":      jobsGet,
-	"start":    notImplemented, // jobsStart,
-	"stop":     notImplemented, // jobsStop,
-	"register": notImplemented, // jobsRegister,
+// Execute runs a single command line, reporting whether it failed
+func Execute(t string) error {
+	argz, err := SplitArgs(t)
+	if err != nil {
+		printError(err)
+		return err
+	}
+	return ExecuteArgs(argz)
 }
 
+// Executor runs a command line typed at the prompt, and adds it to the
+// history. history commands are left out, history records what they run.
+// A line recalled from the history with a redacted secret is refused,
+// rather than sending the placeholder as the secret.
 func Executor(t string) {
-	argz := strings.Split(t, " ")
-	if len(argz) > 0 {
-		cmd, ok := commandMap[argz[0]]
-		if ok {
-			out, err := cmd(argz)
-			if err != nil {
-				//				DebugOut("here1")
-				fmt.Println(Errorf("%s", err.Error()))
-			} else {
-				//				DebugOut("here2")
-				fmt.Println(out)
-			}
-		} else {
-			fmt.Printf("%s\n", Errorf("no command: %s", argz[0]))
-		}
+	if hasRedactedSecret(t) {
+		fmt.Println(Errorf("The line has a redacted secret from the history, type the secret again"))
+		return
+	}
+	if fields := strings.Fields(t); len(fields) > 0 && fields[0] != "history" {
+		recordHistory(t)
 	}
-	//	fmt.Printf("Unhandled <%s>\n", t)
+	Execute(t)
 }
 
 var defaultClient *MaestroClient
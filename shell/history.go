@@ -0,0 +1,211 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	prompt "github.com/c-bata/go-prompt"
+)
+
+const (
+	// DefaultHistoryFile is the history file name, in the home directory
+	DefaultHistoryFile = ".maestro_shell_history"
+	// MaxHistoryEntries is how many commands the history file keeps
+	MaxHistoryEntries = 1000
+	redactedValue     = "********"
+)
+
+// isSecretOption is true if key is a key=value option marked Secret, whose
+// value never reaches the history file or debug output. Keys match
+// ignoring case.
+func isSecretOption(key string) bool {
+	for _, option := range netIfConfigArgs {
+		if option.Secret && strings.EqualFold(option.Name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+var historyPath string
+var historyEntries []string
+
+// DefaultHistoryPath is DefaultHistoryFile in the user's home directory
+func DefaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, DefaultHistoryFile)
+}
+
+// LoadHistory reads the history file at path, and from then on saves each
+// command typed at the prompt to it. The entries are returned oldest first,
+// for prompt.OptionHistory.
+func LoadHistory(path string) (entries []string, err error) {
+	historyPath = path
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			historyEntries = appendHistory(historyEntries, line)
+		}
+	}
+	err = scanner.Err()
+	entries = append(entries, historyEntries...)
+	return
+}
+
+// appendHistory adds line to the end of entries, dropping any earlier copy
+// of it, and the oldest entries once there are more than MaxHistoryEntries
+func appendHistory(entries []string, line string) []string {
+	for i, entry := range entries {
+		if entry == line {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	entries = append(entries, line)
+	if len(entries) > MaxHistoryEntries {
+		entries = entries[len(entries)-MaxHistoryEntries:]
+	}
+	return entries
+}
+
+// redactSecrets replaces the values of secret options in line. Arguments
+// are found the way SplitArgs finds them, so a quoted or escaped secret is
+// replaced whole.
+func redactSecrets(line string) string {
+	tokens, _, _ := scanTokens(line)
+	for i := len(tokens) - 1; i >= 0; i-- {
+		kv := strings.SplitN(tokens[i].text, "=", 2)
+		if len(kv) < 2 || !isSecretOption(kv[0]) {
+			continue
+		}
+		line = line[:tokens[i].start] + kv[0] + "=" + redactedValue + line[tokens[i].end:]
+	}
+	return line
+}
+
+// hasRedactedSecret is true if line has a secret that redactSecrets
+// replaced, as history entries do
+func hasRedactedSecret(line string) bool {
+	args, _, _ := tokenize(line)
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) == 2 && kv[1] == redactedValue && isSecretOption(kv[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordHistory adds a command run at the prompt to the history, and saves
+// the history file
+func recordHistory(line string) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	historyEntries = appendHistory(historyEntries, redactSecrets(line))
+	if len(historyPath) == 0 {
+		return
+	}
+	data := strings.Join(historyEntries, "\n") + "\n"
+	if err := ioutil.WriteFile(historyPath, []byte(data), 0600); err != nil {
+		DebugOut("could not save history to %s: %s", historyPath, err.Error())
+	}
+}
+
+// cmdHistory lists the history, or with a number, runs that entry again
+func cmdHistory(args []string) (out string, err error) {
+	if len(args) < 2 {
+		lines := make([]string, 0, len(historyEntries))
+		for i, entry := range historyEntries {
+			lines = append(lines, fmt.Sprintf("%5d  %s", i+1, entry))
+		}
+		out = strings.Join(lines, "\n")
+		return
+	}
+	n, err2 := strconv.Atoi(args[1])
+	if err2 != nil || len(args) > 2 {
+		err = errors.New("Usage: history [number]")
+		return
+	}
+	if n < 1 || n > len(historyEntries) {
+		err = fmt.Errorf("No history entry %d", n)
+		return
+	}
+	line := historyEntries[n-1]
+	if hasRedactedSecret(line) {
+		err = fmt.Errorf("History entry %d has a redacted secret, type it again instead", n)
+		return
+	}
+	argz, err := SplitArgs(line)
+	if err != nil || len(argz) < 1 {
+		return
+	}
+	if argz[0] == "history" {
+		err = errors.New("Can not run history from history")
+		return
+	}
+	fmt.Println(line)
+	recordHistory(line)
+	return runArgs(argz)
+}
+
+// reverse search state, see ReverseSearchHistory
+var historySearch struct {
+	term string
+	pos  int
+	last string
+}
+
+// ReverseSearchHistory is bound to Ctrl-R. It replaces the line being typed
+// with the newest history entry containing it. Pressing Ctrl-R again goes
+// on to older matches.
+func ReverseSearchHistory(buf *prompt.Buffer) {
+	text := buf.Text()
+	if text != historySearch.last || len(historySearch.last) == 0 {
+		historySearch.term = text
+		historySearch.pos = len(historyEntries)
+	}
+	for i := historySearch.pos - 1; i >= 0; i-- {
+		if strings.Contains(historyEntries[i], historySearch.term) {
+			historySearch.pos = i
+			historySearch.last = historyEntries[i]
+			buf.DeleteBeforeCursor(len([]rune(buf.Document().TextBeforeCursor())))
+			buf.Delete(len([]rune(buf.Document().TextAfterCursor())))
+			buf.InsertText(historyEntries[i], false, true)
+			return
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// maestroSpecs.IEEE8021x has no fields yet, so the 802.1X settings are
+// described here, and sent in its place as the interface's "ieee8021x".
+// Certificates and keys are read by the shell and sent as PEM, as the
+// shell may not be running on the gateway.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// EAP methods maestro can use for 802.1X
+const (
+	EapTLS  = "TLS"
+	EapPEAP = "PEAP"
+	EapTTLS = "TTLS"
+	EapPWD  = "PWD"
+)
+
+var eapMethods = []string{EapTLS, EapPEAP, EapTTLS, EapPWD}
+
+// IEEE8021xConfig is the 802.1X authentication for an interface
+type IEEE8021xConfig struct {
+	EapMethod string `json:"eap_method"`
+	Identity  string `json:"identity,omitempty"`
+	Password  string `json:"password,omitempty"`
+	// PEM encoded CA certificates to verify the authentication server with
+	CaCert string `json:"ca_cert,omitempty"`
+	// PEM encoded client certificate and private key, for EAP-TLS
+	ClientCert         string `json:"client_cert,omitempty"`
+	PrivateKey         string `json:"private_key,omitempty"`
+	PrivateKeyPassword string `json:"private_key_password,omitempty"`
+}
+
+// ieee8021xOptions are the 802.1X options of "net config-interface", with
+// file paths rather than the files' contents
+type ieee8021xOptions struct {
+	set                bool
+	eapMethod          string
+	identity           string
+	password           string
+	caCertPath         string
+	clientCertPath     string
+	privateKeyPath     string
+	privateKeyPassword string
+}
+
+// setOption sets the 802.1X option key, returning false if key is not one
+func (opts *ieee8021xOptions) setOption(key string, value string) bool {
+	switch key {
+	case "eapmethod":
+		opts.eapMethod = value
+	case "eapidentity":
+		opts.identity = value
+	case "eappassword":
+		opts.password = value
+	case "eapcacert":
+		opts.caCertPath = value
+	case "eapclientcert":
+		opts.clientCertPath = value
+	case "eapprivatekey":
+		opts.privateKeyPath = value
+	case "eapprivatekeypassword":
+		opts.privateKeyPassword = value
+	default:
+		return false
+	}
+	opts.set = true
+	return true
+}
+
+// build checks the options go together, and reads and checks the
+// certificate files. It returns nil if no 802.1X options were given.
+func (opts *ieee8021xOptions) build() (auth *IEEE8021xConfig, err error) {
+	if !opts.set {
+		return
+	}
+	method := ""
+	for _, m := range eapMethods {
+		if strings.EqualFold(m, opts.eapMethod) {
+			method = m
+		}
+	}
+	if len(method) == 0 {
+		err = fmt.Errorf("802.1X needs EapMethod, one of %s", strings.Join(eapMethods, ", "))
+		return
+	}
+
+	auth = &IEEE8021xConfig{
+		EapMethod:          method,
+		Identity:           opts.identity,
+		Password:           opts.password,
+		PrivateKeyPassword: opts.privateKeyPassword,
+	}
+	if method == EapTLS {
+		if len(opts.clientCertPath) == 0 || len(opts.privateKeyPath) == 0 {
+			err = errors.New("EAP-TLS needs EapClientCert and EapPrivateKey")
+			return
+		}
+	} else if len(opts.identity) == 0 || len(opts.password) == 0 {
+		err = fmt.Errorf("EAP-%s needs EapIdentity and EapPassword", method)
+		return
+	}
+
+	if len(opts.caCertPath) > 0 {
+		if auth.CaCert, _, err = readCertificates(opts.caCertPath); err != nil {
+			return
+		}
+	}
+	if len(opts.clientCertPath) > 0 {
+		var certs []*x509.Certificate
+		if auth.ClientCert, certs, err = readCertificates(opts.clientCertPath); err != nil {
+			return
+		}
+		if now := time.Now(); now.After(certs[0].NotAfter) {
+			err = fmt.Errorf("%s: certificate expired on %s", opts.clientCertPath, certs[0].NotAfter.Format("2006-01-02"))
+			return
+		} else if now.Before(certs[0].NotBefore) {
+			err = fmt.Errorf("%s: certificate is not valid until %s", opts.clientCertPath, certs[0].NotBefore.Format("2006-01-02"))
+			return
+		}
+	}
+	if len(opts.privateKeyPath) > 0 {
+		if auth.PrivateKey, err = readPrivateKey(opts.privateKeyPath, auth.ClientCert, len(opts.privateKeyPassword) > 0); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readCertificates reads a PEM file which must hold only valid certificates
+func readCertificates(path string) (data string, certs []*x509.Certificate, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	rest := raw
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			err = fmt.Errorf("%s: expected only certificates, found %s", path, block.Type)
+			return
+		}
+		cert, err2 := x509.ParseCertificate(block.Bytes)
+		if err2 != nil {
+			err = fmt.Errorf("%s: invalid certificate: %s", path, err2.Error())
+			return
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		err = fmt.Errorf("%s: no PEM certificates found", path)
+		return
+	}
+	data = string(raw)
+	return
+}
+
+// readPrivateKey reads a PEM private key. An unencrypted key must match
+// the client certificate; an encrypted one needs its password.
+func readPrivateKey(path string, clientCert string, havePassword bool) (data string, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		err = fmt.Errorf("%s: no PEM private key found", path)
+		return
+	}
+	encrypted := block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED")
+	if encrypted {
+		if !havePassword {
+			err = fmt.Errorf("%s: the key is encrypted, set EapPrivateKeyPassword", path)
+			return
+		}
+	} else if len(clientCert) > 0 {
+		if _, err2 := tls.X509KeyPair([]byte(clientCert), raw); err2 != nil {
+			err = fmt.Errorf("%s: does not match the client certificate: %s", path, err2.Error())
+			return
+		}
+	}
+	data = string(raw)
+	return
+}
@@ -0,0 +1,477 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PelionIoT/maestroSpecs"
+	prompt "github.com/c-bata/go-prompt"
+)
+
+// certFileSuggestions completes the path of a certificate or key file
+func certFileSuggestions(path string) []prompt.Suggest {
+	return fileSuggestions(path, ".pem", ".crt", ".cer", ".key")
+}
+
+// routePriorityValues are 0 to maestroSpecs.MaxRoutePriority
+var routePriorityValues = func() (values []ArgSpec) {
+	for i := 0; i <= maestroSpecs.MaxRoutePriority; i++ {
+		var desc string
+		switch i {
+		case 0:
+			desc = "first priority"
+		case maestroSpecs.MaxRoutePriority:
+			desc = "last priority"
+		}
+		values = append(values, ArgSpec{Name: strconv.Itoa(i), Description: desc})
+	}
+	return
+}()
+
+// interfaceTypes are the values Type may take
+var interfaceTypes = []ArgSpec{
+	{Name: "wifi", Description: "Wifi, set WifiSsid and WifiPassword too"},
+	{Name: "lte", Description: "LTE modem, set SerialDevice and APN too"},
+	{Name: "eth", Description: "Wired ethernet"},
+}
+
+// netIfConfigArgs are the options of "net config-interface"
+var netIfConfigArgs = []ArgSpec{
+	{Name: "IfName", Description: "Interface name, like eth0", CompleteValue: func(string) []prompt.Suggest {
+		return interfaceSuggestions()
+	}},
+	{Name: "DhcpV4Enabled", Description: "true or false", Values: boolValues},
+	{Name: "IPv4Addr", Description: "IPv4 Address"},
+	{Name: "IPv4Mask", Description: "IPv4 Netmask integer (CIDR format)"},
+	{Name: "IPv4BCast", Description: "IPv4 Broadcast Address"},
+	{Name: "AliasAddrV4", Description: "Secondary IPv4 addresses, comma separated, like 192.168.1.10/24"},
+	{Name: "alias", Description: "A secondary IPv4 address, like 192.168.1.10/24. Can be given more than once", Repeatable: true},
+	{Name: "IPv6Addr", Description: "IPv6 Address"},
+	{Name: "HwAddr", Description: "MAC Address or similar"},
+	{Name: "EapMethod", Description: "802.1X EAP method", Values: []ArgSpec{
+		{Name: EapTLS, Description: "Client certificate, set EapClientCert and EapPrivateKey too"},
+		{Name: EapPEAP, Description: "Set EapIdentity and EapPassword too"},
+		{Name: EapTTLS, Description: "Set EapIdentity and EapPassword too"},
+		{Name: EapPWD, Description: "Set EapIdentity and EapPassword too"},
+	}},
+	{Name: "EapIdentity", Description: "802.1X identity"},
+	{Name: "EapPassword", Description: "802.1X password", Secret: true},
+	{Name: "EapCaCert", Description: "802.1X CA certificate file (PEM)", CompleteValue: certFileSuggestions},
+	{Name: "EapClientCert", Description: "802.1X client certificate file (PEM), for TLS", CompleteValue: certFileSuggestions},
+	{Name: "EapPrivateKey", Description: "802.1X client private key file (PEM), for TLS", CompleteValue: certFileSuggestions},
+	{Name: "EapPrivateKeyPassword", Description: "Password of an encrypted EapPrivateKey", Secret: true},
+	{Name: "ReplaceAddress", Description: "Address to delete before setting the new address"},
+	{Name: "ClearAddresses", Description: "true or false.  if true, remove all existing addresses before setting the new address", Values: boolValues},
+	{Name: "WifiSsid", Description: "Wifi SSID"},
+	{Name: "WifiPassword", Description: "Wifi Password", Secret: true},
+	{Name: "Down", Description: "true or false.  if true, the interface is disabled", Values: boolValues},
+	{Name: "DefaultGateway", Description: "Default route associated with this interface"},
+	//{Name: "FallbackDefaultGateway", Description: "NOT IMPLEMENTED"},
+	{Name: "RoutePriority", Description: "Interface priority as a default route, ranked across all interfaces.  range 0-9, 0=first priority, 9=last", Values: routePriorityValues},
+	{Name: "Aux", Description: "true or false", Values: boolValues},
+	{Name: "NameserverOverrides", Description: "Override DNS"},
+	{Name: "Routes", Description: "Static routes, comma separated, like 10.0.0.0/8via192.168.1.1"},
+	{Name: "route", Description: "A static route, like 10.0.0.0/8via192.168.1.1. Can be given more than once", Repeatable: true},
+	{Name: "TestHttpsRouteOut", Description: "https:// URL maestro fetches to check the interface has a route out"},
+	{Name: "TestICMPv4EchoOut", Description: "Host or IPv4 address maestro pings to check the interface has a route out"},
+	{Name: "DhcpDisableClearAddresses", Description: "Don't allow DHCP to clear all addresses", Values: boolValues},
+	{Name: "DhcpStepTimeout", Description: "Max seconds to wait for DHCP address"},
+	{Name: "Existing", Description: "override=replace any data in the db, replace=remove any data in the db", Values: []ArgSpec{
+		{Name: "override", Description: "Replace any data in the db"},
+		{Name: "replace", Description: "Remove any data in the db"},
+	}},
+	{Name: "Type", Description: "Type of the connection, such as wifi or lte", Values: interfaceTypes},
+	{Name: "SerialDevice", Description: "Path to the LTE modem serial device"},
+	{Name: "APN", Description: "LTE modem access point name"},
+}
+
+// parseNetIfConfig builds an interface config, and its 802.1X
+// authentication if any, from the Key=value options of "net config-interface"
+func parseNetIfConfig(args []string) (netIfConfig maestroSpecs.NetIfConfigPayload, auth *IEEE8021xConfig, err error) {
+	// check for addition args beyond "net config-interface"
+	if len(args)-2 <= 0 {
+		err = errors.New("Missing interface options")
+		return
+	}
+
+	var routes []staticRoute
+	var authOpts ieee8021xOptions
+	for _, opt := range args[2:] {
+		val := strings.SplitN(opt, "=", 2)
+		if len(val) < 2 {
+			err = fmt.Errorf("Invalid option: %s", opt)
+			return
+		}
+		if isSecretOption(val[0]) {
+			DebugOut("opt=%s, arg=%s", val[0], redactedValue)
+		} else {
+			DebugOut("opt=%s, arg=%s", val[0], val[1])
+		}
+		if authOpts.setOption(strings.ToLower(val[0]), val[1]) {
+			continue
+		}
+		switch strings.ToLower(val[0]) {
+		case "type":
+			netIfConfig.Type = strings.ToLower(val[1])
+		case "ifname":
+			netIfConfig.IfName = val[1]
+		case "ifindex":
+			i, err2 := strconv.Atoi(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be a number", val[0], val[1])
+				return
+			}
+			netIfConfig.IfIndex = i
+		case "dhcpv4enabled":
+			b, err2 := strconv.ParseBool(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be true or false", val[0], val[1])
+				return
+			}
+			netIfConfig.DhcpV4Enabled = b
+		case "ipv4addr":
+			netIfConfig.IPv4Addr = val[1]
+		case "ipv4mask":
+			i, err2 := strconv.Atoi(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be a number", val[0], val[1])
+				return
+			}
+			netIfConfig.IPv4Mask = i
+		case "ipv4bcast":
+			netIfConfig.IPv4BCast = val[1]
+		case "ipv6addr":
+			netIfConfig.IPv6Addr = val[1]
+		case "hwaddr":
+			netIfConfig.HwAddr = val[1]
+		case "replaceaddress":
+			netIfConfig.ReplaceAddress = val[1]
+		case "clearaddresses":
+			b, err2 := strconv.ParseBool(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be true or false", val[0], val[1])
+				return
+			}
+			netIfConfig.ClearAddresses = b
+		case "wifissid":
+			netIfConfig.WifiSsid = val[1]
+		case "wifipassword":
+			netIfConfig.WifiPassword = val[1]
+		case "down":
+			b, err2 := strconv.ParseBool(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be true or false", val[0], val[1])
+				return
+			}
+			netIfConfig.Down = b
+		case "defaultgateway":
+			netIfConfig.DefaultGateway = val[1]
+		case "fallbackdefaultgateway":
+			netIfConfig.FallbackDefaultGateway = val[1]
+		case "routepriority":
+			i, err2 := strconv.Atoi(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be a number", val[0], val[1])
+				return
+			}
+			netIfConfig.RoutePriority = i
+		case "aux":
+			b, err2 := strconv.ParseBool(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be true or false", val[0], val[1])
+				return
+			}
+			netIfConfig.Aux = b
+		case "nameserveroverrides":
+			netIfConfig.NameserverOverrides = val[1]
+		case "dhcpdisableclearaddresses":
+			b, err2 := strconv.ParseBool(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be true or false", val[0], val[1])
+				return
+			}
+			netIfConfig.DhcpDisableClearAddresses = b
+		case "dhcpsteptimeout":
+			i, err2 := strconv.Atoi(val[1])
+			if err2 != nil {
+				err = fmt.Errorf("Invalid %s %s: must be a number", val[0], val[1])
+				return
+			}
+			netIfConfig.DhcpStepTimeout = i
+		case "existing":
+			netIfConfig.Existing = val[1]
+		case "serialdevice":
+			netIfConfig.SerialDevice = val[1]
+		case "apn":
+			netIfConfig.AccessPointName = val[1]
+		case "testhttpsrouteout":
+			if err = checkHttpsTestURL(val[1]); err != nil {
+				return
+			}
+			netIfConfig.TestHttpsRouteOut = val[1]
+		case "testicmpv4echoout":
+			if err = checkEchoTestHost(val[1]); err != nil {
+				return
+			}
+			netIfConfig.TestICMPv4EchoOut = val[1]
+		case "aliasaddrv4", "alias":
+			for _, spec := range strings.Split(val[1], ",") {
+				alias, err2 := parseAliasAddr(spec)
+				if err2 != nil {
+					err = err2
+					return
+				}
+				netIfConfig.AliasAddrV4 = append(netIfConfig.AliasAddrV4, alias)
+			}
+		case "routes", "route":
+			for _, spec := range strings.Split(val[1], ",") {
+				route, err2 := parseRoute(spec)
+				if err2 != nil {
+					err = err2
+					return
+				}
+				routes = append(routes, route)
+			}
+		default:
+			err = fmt.Errorf("Unknown option: %s (see \"help net config-interface\")", val[0])
+			return
+		}
+	}
+
+	if err = checkNetIfConfig(netIfConfig); err != nil {
+		return
+	}
+	if auth, err = authOpts.build(); err != nil {
+		return
+	}
+	if err = checkRoutes(netIfConfig, routes); err != nil {
+		return
+	}
+	for _, route := range routes {
+		netIfConfig.Routes = append(netIfConfig.Routes, route.String())
+	}
+
+	if netIfConfig.IfName == "" {
+		err = errors.New("Missing IfName")
+	}
+	return
+}
+
+// checkNetIfConfig checks the format and range of each setting, so a bad
+// value is caught before it is sent to maestro
+func checkNetIfConfig(config maestroSpecs.NetIfConfigPayload) error {
+	if len(config.Type) > 0 {
+		known := make([]string, 0, len(interfaceTypes))
+		found := false
+		for _, t := range interfaceTypes {
+			known = append(known, t.Name)
+			if t.Name == config.Type {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("Invalid Type %s: must be one of %s", config.Type, strings.Join(known, ", "))
+		}
+	}
+	if config.IfIndex < 0 {
+		return fmt.Errorf("Invalid IfIndex %d: must not be negative", config.IfIndex)
+	}
+	if len(config.HwAddr) > 0 {
+		if _, err := net.ParseMAC(config.HwAddr); err != nil {
+			return fmt.Errorf("Invalid HwAddr %s: must be a MAC address, like aa:bb:cc:01:23:45", config.HwAddr)
+		}
+	}
+	ipv4Settings := []struct {
+		name  string
+		value string
+	}{
+		{"IPv4Addr", config.IPv4Addr},
+		{"IPv4BCast", config.IPv4BCast},
+		{"DefaultGateway", config.DefaultGateway},
+		{"FallbackDefaultGateway", config.FallbackDefaultGateway},
+	}
+	for _, setting := range ipv4Settings {
+		if len(setting.value) == 0 {
+			continue
+		}
+		if err := checkAddress(setting.name, setting.value, "IPv4"); err != nil {
+			return err
+		}
+	}
+	if len(config.IPv6Addr) > 0 {
+		if err := checkAddress("IPv6Addr", config.IPv6Addr, "IPv6"); err != nil {
+			return err
+		}
+	}
+	if len(config.ReplaceAddress) > 0 {
+		if err := checkAddress("ReplaceAddress", config.ReplaceAddress, ""); err != nil {
+			return err
+		}
+	}
+	if config.IPv4Mask < 0 || config.IPv4Mask > 32 {
+		return fmt.Errorf("Invalid IPv4Mask %d: must be 0 to 32", config.IPv4Mask)
+	}
+	if config.RoutePriority < 0 || config.RoutePriority > maestroSpecs.MaxRoutePriority {
+		return fmt.Errorf("Invalid RoutePriority %d: must be 0 to %d", config.RoutePriority, maestroSpecs.MaxRoutePriority)
+	}
+	if config.DhcpStepTimeout < 0 {
+		return fmt.Errorf("Invalid DhcpStepTimeout %d: must not be negative", config.DhcpStepTimeout)
+	}
+	switch config.Existing {
+	case "", "override", "replace":
+	default:
+		return fmt.Errorf("Invalid Existing %s: must be override or replace", config.Existing)
+	}
+	return nil
+}
+
+// checkAddress checks the setting name is a single address of family,
+// "IPv4" or "IPv6", or of either if family is empty. Addresses of both
+// families are given without a prefix length, as IPv4Mask holds the mask.
+func checkAddress(name string, addr string, family string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		if _, _, err := net.ParseCIDR(addr); err == nil {
+			return fmt.Errorf("Invalid %s %s: give the address without a prefix length", name, addr)
+		}
+	}
+	switch {
+	case ip == nil && len(family) == 0:
+		return fmt.Errorf("Invalid %s %s: must be an IP address", name, addr)
+	case family == "IPv4" && (ip == nil || ip.To4() == nil):
+		return fmt.Errorf("Invalid %s %s: must be an IPv4 address", name, addr)
+	case family == "IPv6" && (ip == nil || ip.To4() != nil):
+		return fmt.Errorf("Invalid %s %s: must be an IPv6 address", name, addr)
+	}
+	return nil
+}
+
+// checkHttpsTestURL checks a TestHttpsRouteOut URL is an https URL
+func checkHttpsTestURL(testURL string) error {
+	u, err := url.Parse(testURL)
+	if err != nil || u.Scheme != "https" || len(u.Hostname()) == 0 {
+		return fmt.Errorf("Invalid TestHttpsRouteOut %s: must be an https URL, like https://www.example.com/", testURL)
+	}
+	return nil
+}
+
+var hostnamePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9\-]{0,61}[A-Za-z0-9])?)(\.[A-Za-z0-9]([A-Za-z0-9\-]{0,61}[A-Za-z0-9])?)*\.?$`)
+
+// checkEchoTestHost checks a TestICMPv4EchoOut host is an IPv4 address or
+// a valid host name
+func checkEchoTestHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return fmt.Errorf("Invalid TestICMPv4EchoOut %s: must be an IPv4 address or host name", host)
+		}
+		return nil
+	}
+	if len(host) > 253 || !hostnamePattern.MatchString(host) {
+		return fmt.Errorf("Invalid TestICMPv4EchoOut %s: must be an IPv4 address or host name", host)
+	}
+	return nil
+}
+
+// parseAliasAddr parses a secondary address given as <address>/<bits>
+func parseAliasAddr(spec string) (alias maestroSpecs.AliasAddressV4, err error) {
+	spec = strings.TrimSpace(spec)
+	ip, ipnet, err2 := net.ParseCIDR(spec)
+	if err2 != nil || ip.To4() == nil {
+		err = fmt.Errorf("Invalid alias %s: must be an IPv4 address and mask, like 192.168.1.10/24", spec)
+		return
+	}
+	bits, _ := ipnet.Mask.Size()
+	alias.IPv4Addr = ip.To4().String()
+	alias.IPv4Mask = strconv.Itoa(bits)
+	return
+}
+
+// staticRoute is a route to network, through gateway if it is set
+type staticRoute struct {
+	network *net.IPNet
+	gateway net.IP
+}
+
+// String is the route the way it is sent to maestro, like
+// "10.0.0.0/8 via 192.168.1.1"
+func (route staticRoute) String() string {
+	if route.gateway == nil {
+		return route.network.String()
+	}
+	return fmt.Sprintf("%s via %s", route.network, route.gateway)
+}
+
+// parseRoute parses <network>/<bits>via<gateway>, or just <network>/<bits>
+// for a route with no gateway
+func parseRoute(spec string) (route staticRoute, err error) {
+	spec = strings.TrimSpace(spec)
+	network := spec
+	gateway := ""
+	if i := strings.Index(strings.ToLower(spec), "via"); i >= 0 {
+		network = strings.TrimSpace(spec[:i])
+		gateway = strings.TrimSpace(spec[i+3:])
+		if len(gateway) == 0 {
+			err = fmt.Errorf("Invalid route %s: missing gateway after via", spec)
+			return
+		}
+	}
+	ip, ipnet, err2 := net.ParseCIDR(network)
+	if err2 != nil || ip.To4() == nil {
+		err = fmt.Errorf("Invalid route %s: %s is not an IPv4 network like 10.0.0.0/8", spec, network)
+		return
+	}
+	if !ip.Equal(ipnet.IP) {
+		err = fmt.Errorf("Invalid route %s: %s has host bits set, did you mean %s?", spec, network, ipnet)
+		return
+	}
+	route.network = ipnet
+	if len(gateway) > 0 {
+		route.gateway = net.ParseIP(gateway).To4()
+		if route.gateway == nil {
+			err = fmt.Errorf("Invalid route %s: gateway %s is not an IPv4 address", spec, gateway)
+			return
+		}
+	}
+	return
+}
+
+// checkRoutes makes sure each gateway can be reached directly, being in
+// the interface's subnet. This can only be checked when the command sets
+// the interface's address, rather than leaving it to DHCP or to whatever
+// maestro already has.
+func checkRoutes(config maestroSpecs.NetIfConfigPayload, routes []staticRoute) error {
+	if len(config.IPv4Addr) == 0 || config.IPv4Mask <= 0 {
+		return nil
+	}
+	addr := net.ParseIP(config.IPv4Addr).To4()
+	if addr == nil || config.IPv4Mask > 32 {
+		return nil
+	}
+	subnet := &net.IPNet{IP: addr.Mask(net.CIDRMask(config.IPv4Mask, 32)), Mask: net.CIDRMask(config.IPv4Mask, 32)}
+	for _, route := range routes {
+		if route.gateway != nil && !subnet.Contains(route.gateway) {
+			return fmt.Errorf("Invalid route %s: gateway %s is not in the interface's subnet %s", route, route.gateway, subnet)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PelionIoT/maestroSpecs"
+)
+
+func TestParseNetIfConfig(t *testing.T) {
+	tests := []struct {
+		opts string
+		// err, if set, is the start of the expected error
+		err string
+		// check, if set, checks the parsed config
+		check func(config maestroSpecs.NetIfConfigPayload) bool
+	}{
+		{opts: "", err: "Missing interface options"},
+		{opts: "Type=eth", err: "Missing IfName"},
+		{opts: "IfName", err: "Invalid option"},
+		{opts: "IfName=eth0 Bogus=1", err: "Unknown option: Bogus"},
+		{opts: "IfName=eth0 ipv4address=10.0.0.2", err: "Unknown option: ipv4address"},
+
+		// MAC addresses go to HwAddr
+		{opts: "IfName=eth0 HwAddr=aa:bb:cc:01:23:45 IPv6Addr=fe80::1", check: func(c maestroSpecs.NetIfConfigPayload) bool {
+			return c.HwAddr == "aa:bb:cc:01:23:45" && c.IPv6Addr == "fe80::1"
+		}},
+		{opts: "IfName=eth0 HwAddr=AA-BB-CC-01-23-45"},
+		{opts: "IfName=eth0 HwAddr=zz:11", err: "Invalid HwAddr"},
+		{opts: "IfName=eth0 HwAddr=aa:bb:cc:01:23", err: "Invalid HwAddr"},
+
+		// addresses, without a prefix length for either family
+		{opts: "IfName=eth0 IPv4Addr=10.0.0.2 IPv4Mask=24 IPv4BCast=10.0.0.255 DefaultGateway=10.0.0.1"},
+		{opts: "IfName=eth0 IPv4Addr=300.1.1.1", err: "Invalid IPv4Addr"},
+		{opts: "IfName=eth0 IPv4Addr=10.0.0.2/24", err: "Invalid IPv4Addr 10.0.0.2/24: give the address without a prefix length"},
+		{opts: "IfName=eth0 IPv4Addr=fe80::1", err: "Invalid IPv4Addr"},
+		{opts: "IfName=eth0 DefaultGateway=gw", err: "Invalid DefaultGateway"},
+		{opts: "IfName=eth0 IPv6Addr=fe80::1/64", err: "Invalid IPv6Addr fe80::1/64: give the address without a prefix length"},
+		{opts: "IfName=eth0 IPv6Addr=10.0.0.1", err: "Invalid IPv6Addr"},
+		{opts: "IfName=eth0 ReplaceAddress=fe80::2"},
+		{opts: "IfName=eth0 ReplaceAddress=10.0.0.9"},
+		{opts: "IfName=eth0 ReplaceAddress=x", err: "Invalid ReplaceAddress"},
+
+		// mask 0 to 32
+		{opts: "IfName=eth0 IPv4Mask=0"},
+		{opts: "IfName=eth0 IPv4Mask=32"},
+		{opts: "IfName=eth0 IPv4Mask=33", err: "Invalid IPv4Mask 33"},
+		{opts: "IfName=eth0 IPv4Mask=-1", err: "Invalid IPv4Mask -1"},
+		{opts: "IfName=eth0 IPv4Mask=abc", err: "Invalid IPv4Mask abc: must be a number"},
+
+		// RoutePriority 0 to 9
+		{opts: "IfName=eth0 RoutePriority=0"},
+		{opts: "IfName=eth0 RoutePriority=9"},
+		{opts: "IfName=eth0 RoutePriority=10", err: "Invalid RoutePriority 10"},
+		{opts: "IfName=eth0 RoutePriority=-1", err: "Invalid RoutePriority -1"},
+
+		// Type is one of the known types, lowercased
+		{opts: "IfName=wlan0 Type=WIFI", check: func(c maestroSpecs.NetIfConfigPayload) bool {
+			return c.Type == "wifi"
+		}},
+		{opts: "IfName=eth0 Type=foo", err: "Invalid Type foo"},
+		{opts: "IfName=eth0 IfIndex=-1", err: "Invalid IfIndex -1"},
+		{opts: "IfName=eth0 Down=maybe", err: "Invalid Down maybe: must be true or false"},
+		{opts: "IfName=eth0 Existing=nope", err: "Invalid Existing"},
+
+		// values may hold =
+		{opts: "IfName=eth0 TestHttpsRouteOut=https://example.com/?a=b", check: func(c maestroSpecs.NetIfConfigPayload) bool {
+			return c.TestHttpsRouteOut == "https://example.com/?a=b"
+		}},
+
+		// routes, whose gateways must be in the interface's subnet
+		{opts: "IfName=eth0 IPv4Addr=192.168.1.5 IPv4Mask=24 Routes=10.0.0.0/8via192.168.1.1,172.16.0.0/12", check: func(c maestroSpecs.NetIfConfigPayload) bool {
+			return reflect.DeepEqual(c.Routes, []string{"10.0.0.0/8 via 192.168.1.1", "172.16.0.0/12"})
+		}},
+		{opts: "IfName=eth0 IPv4Addr=192.168.1.5 IPv4Mask=24 route=10.0.0.0/8via192.168.2.1", err: "Invalid route 10.0.0.0/8 via 192.168.2.1: gateway 192.168.2.1 is not in the interface's subnet 192.168.1.0/24"},
+		{opts: "IfName=eth0 route=10.0.0.0/8VIA192.168.2.1"},
+		{opts: "IfName=eth0 route=10.0.0.1/8", err: "Invalid route 10.0.0.1/8: 10.0.0.1/8 has host bits set"},
+		{opts: "IfName=eth0 route=10.0.0.0/8via", err: "Invalid route 10.0.0.0/8via: missing gateway"},
+
+		// aliases
+		{opts: "IfName=eth0 alias=192.168.1.10/24 alias=10.9.0.1/16", check: func(c maestroSpecs.NetIfConfigPayload) bool {
+			return len(c.AliasAddrV4) == 2 && c.AliasAddrV4[1].IPv4Addr == "10.9.0.1" && c.AliasAddrV4[1].IPv4Mask == "16"
+		}},
+		{opts: "IfName=eth0 alias=192.168.1.10", err: "Invalid alias"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"net", "config-interface"}, strings.Fields(tt.opts)...)
+		config, _, err := parseNetIfConfig(args)
+		if len(tt.err) > 0 {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%q: error = %v, want %q...", tt.opts, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.opts, err)
+			continue
+		}
+		if tt.check != nil && !tt.check(config) {
+			t.Errorf("%q: unexpected config %+v", tt.opts, config)
+		}
+	}
+}
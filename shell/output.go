@@ -0,0 +1,269 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// OutputPretty is the human readable "easy read" format
+	OutputPretty = "pretty"
+	// OutputJSON emits maestro's response as indented JSON
+	OutputJSON = "json"
+	// OutputYAML emits maestro's response as YAML
+	OutputYAML = "yaml"
+)
+
+var outputModes = []string{OutputPretty, OutputJSON, OutputYAML}
+
+var outputMode = OutputPretty
+
+func checkOutputMode(mode string) error {
+	for _, m := range outputModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown output mode %q, must be one of %s", mode, strings.Join(outputModes, ", "))
+}
+
+// SetOutputMode sets how getters print maestro's responses:
+// pretty, json or yaml
+func SetOutputMode(mode string) error {
+	if err := checkOutputMode(mode); err != nil {
+		return err
+	}
+	outputMode = mode
+	return nil
+}
+
+// GetOutputMode returns the current output mode
+func GetOutputMode() string {
+	return outputMode
+}
+
+// formatOutput renders a raw maestro JSON response in the current output
+// mode. title is only used by the pretty format.
+func formatOutput(title string, rawjson []byte) (out string, err error) {
+	switch outputMode {
+	case OutputJSON:
+		var buf bytes.Buffer
+		err = json.Indent(&buf, rawjson, "", "  ")
+		out = buf.String()
+	case OutputYAML:
+		var data interface{}
+		var b []byte
+		dec := json.NewDecoder(bytes.NewReader(rawjson))
+		dec.UseNumber()
+		if data, err = orderedJSON(dec); err == nil {
+			b, err = yaml.Marshal(data)
+		}
+		out = strings.TrimRight(string(b), "\n")
+	default:
+		var buf bytes.Buffer
+		buf.WriteString(title)
+		out, err = FormatJsonEasyRead(&buf, rawjson)
+	}
+	return
+}
+
+// orderedJSON decodes the next JSON value from dec, keeping the key order
+// of objects by decoding them as yaml.MapSlice
+func orderedJSON(dec *json.Decoder) (val interface{}, err error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := yaml.MapSlice{}
+			for dec.More() {
+				var key json.Token
+				if key, err = dec.Token(); err != nil {
+					return
+				}
+				var v interface{}
+				if v, err = orderedJSON(dec); err != nil {
+					return
+				}
+				obj = append(obj, yaml.MapItem{Key: key, Value: v})
+			}
+			_, err = dec.Token()
+			val = obj
+		case '[':
+			arr := []interface{}{}
+			for dec.More() {
+				var v interface{}
+				if v, err = orderedJSON(dec); err != nil {
+					return
+				}
+				arr = append(arr, v)
+			}
+			_, err = dec.Token()
+			val = arr
+		}
+	case json.Number:
+		if i, err2 := t.Int64(); err2 == nil {
+			val = i
+		} else {
+			val, err = t.Float64()
+		}
+	default:
+		val = t
+	}
+	return
+}
+
+// extractOutputFlag removes a per command --output <mode> or --output=<mode>
+// from args, returning the mode asked for, if any
+func extractOutputFlag(args []string) (rest []string, mode string, err error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--output":
+			if i+1 >= len(args) {
+				err = fmt.Errorf("--output needs one of %s", strings.Join(outputModes, ", "))
+				return
+			}
+			i++
+			mode = args[i]
+		case strings.HasPrefix(arg, "--output="):
+			mode = strings.TrimPrefix(arg, "--output=")
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		if err = checkOutputMode(mode); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// DefaultEasyReadIndent is the indent used by FormatJsonEasyRead
+const DefaultEasyReadIndent = "    "
+
+var easyReadPlainKey = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// quoteEasyRead quotes a string the way JSON would, without escaping HTML
+func quoteEasyRead(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// FormatJsonEasyRead renders rawjson in the "easy read" format, appending it
+// to whatever is already in out. See FormatJsonEasyReadIndent.
+func FormatJsonEasyRead(out *bytes.Buffer, rawjson []byte) (outs string, err error) {
+	return FormatJsonEasyReadIndent(out, rawjson, DefaultEasyReadIndent)
+}
+
+// FormatJsonEasyReadIndent renders rawjson in the "easy read" format, using
+// indent for each level of nesting. Object keys are sorted and numbers are
+// printed exactly as maestro sent them, so the output is stable between runs.
+func FormatJsonEasyReadIndent(out *bytes.Buffer, rawjson []byte, indent string) (outs string, err error) {
+	var data interface{}
+
+	var fromjson func(d interface{}, level int)
+	fromjson = func(d interface{}, level int) {
+		space := strings.Repeat(indent, level)
+		switch val := d.(type) {
+		case []interface{}:
+			if len(val) == 0 {
+				out.WriteString("[]")
+				return
+			}
+			out.WriteString("[\n")
+			for i, u := range val {
+				out.WriteString(fmt.Sprintf("%s%s[%d]: ", space, indent, i))
+				fromjson(u, level+1)
+				out.WriteString("\n")
+			}
+			out.WriteString(fmt.Sprintf("%s]", space))
+		case map[string]interface{}:
+			if len(val) == 0 {
+				out.WriteString("{}")
+				return
+			}
+			keys := make([]string, 0, len(val))
+			for k := range val {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			out.WriteString("{\n")
+			for _, k := range keys {
+				name := k
+				if !easyReadPlainKey.MatchString(k) {
+					name = quoteEasyRead(k)
+				}
+				out.WriteString(fmt.Sprintf("%s%s%s: ", space, indent, name))
+				fromjson(val[k], level+1)
+				out.WriteString("\n")
+			}
+			out.WriteString(fmt.Sprintf("%s}", space))
+		case nil:
+			out.WriteString("null")
+		case bool:
+			if val {
+				out.WriteString("true")
+			} else {
+				out.WriteString("false")
+			}
+		case string:
+			out.WriteString(quoteEasyRead(val))
+		case json.Number:
+			out.WriteString(val.String())
+		default:
+			err = fmt.Errorf("generic JSON decode went to unknown type. %s", reflect.TypeOf(d))
+			out.WriteString(fmt.Sprintf("<can't handle type. %s>", reflect.TypeOf(d)))
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rawjson))
+	dec.UseNumber()
+	err = dec.Decode(&data)
+	if err == nil {
+		out.WriteString("\n")
+		// a top level list is shown one entry per line, without brackets
+		if list, ok := data.([]interface{}); ok && len(list) > 0 {
+			for i, u := range list {
+				out.WriteString(fmt.Sprintf("[%d]: ", i))
+				fromjson(u, 0)
+				out.WriteString("\n")
+			}
+		} else {
+			fromjson(data, 0)
+			out.WriteString("\n")
+		}
+	}
+
+	outs = out.String()
+
+	return
+}
@@ -0,0 +1,145 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatJsonEasyRead(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "sorted keys",
+			in:   `{"b":1,"a":{"d":true,"c":null}}`,
+			want: `
+{
+    a: {
+        c: null
+        d: true
+    }
+    b: 1
+}
+`,
+		},
+		{
+			name: "numbers as sent",
+			in:   `{"n":2,"f":2.5,"big":12345678901234567890,"e":1e3}`,
+			want: `
+{
+    big: 12345678901234567890
+    e: 1e3
+    f: 2.5
+    n: 2
+}
+`,
+		},
+		{
+			name: "escaped strings",
+			in:   `{"s":"say \"hi\"\n\ttab \u0001 <b>&"}`,
+			want: `
+{
+    s: "say \"hi\"\n\ttab \u0001 <b>&"
+}
+`,
+		},
+		{
+			name: "quoted keys",
+			in:   `{"weird key":1,"ok_key-1.2":2}`,
+			want: `
+{
+    ok_key-1.2: 2
+    "weird key": 1
+}
+`,
+		},
+		{
+			name: "empty object",
+			in:   `{}`,
+			want: "\n{}\n",
+		},
+		{
+			name: "empty list",
+			in:   `[]`,
+			want: "\n[]\n",
+		},
+		{
+			name: "empty nested",
+			in:   `{"a":{},"b":[]}`,
+			want: `
+{
+    a: {}
+    b: []
+}
+`,
+		},
+		{
+			name: "top level list",
+			in:   `[{"x":1},"y"]`,
+			want: `
+[0]: {
+    x: 1
+}
+[1]: "y"
+`,
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		got, err := FormatJsonEasyRead(&buf, []byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatJsonEasyReadIndent(t *testing.T) {
+	var buf bytes.Buffer
+	got, err := FormatJsonEasyReadIndent(&buf, []byte(`{"a":{"b":[1,2]}}`), "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\n{\n\ta: {\n\t\tb: [\n\t\t\t[0]: 1\n\t\t\t[1]: 2\n\t\t]\n\t}\n}\n"
+	if got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFormatJsonEasyReadAppends(t *testing.T) {
+	buf := bytes.NewBufferString("title:")
+	got, err := FormatJsonEasyRead(buf, []byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "title:\n{\n    a: 1\n}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatJsonEasyReadInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := FormatJsonEasyRead(&buf, []byte(`{"a":`)); err == nil {
+		t.Error("expected an error for truncated JSON")
+	}
+}
@@ -0,0 +1,369 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A small jq like query language, evaluated on the decoded JSON a getter
+// returns. A query is a chain of steps:
+//
+//   .field       the field of an object. Field names match ignoring case,
+//                '_' and '-', so .IfName finds "if_name"
+//   []           every element of a list
+//   [N]          element N of a list
+//   [?f=value]   the elements of a list whose field f is (or with != is not) value
+//
+// For example: net get-interfaces --query '[?Type=wifi][].IfName'
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	queryStepField = iota
+	queryStepIterate
+	queryStepIndex
+	queryStepFilter
+)
+
+type queryStep struct {
+	kind  int
+	name  string
+	index int
+	// for queryStepFilter
+	value  string
+	negate bool
+}
+
+type query []queryStep
+
+func normalizeQueryName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Replace(name, "_", "", -1)
+	return strings.Replace(name, "-", "", -1)
+}
+
+func isQueryNameChar(c byte) bool {
+	return c == '_' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parseQuery parses a query expression, see the top of this file
+func parseQuery(expr string) (q query, err error) {
+	expr = strings.TrimSpace(expr)
+	if len(expr) == 0 {
+		err = errors.New("Empty query")
+		return
+	}
+	i := 0
+	for i < len(expr) {
+		switch {
+		case expr[i] == '.':
+			i++
+			start := i
+			for i < len(expr) && isQueryNameChar(expr[i]) {
+				i++
+			}
+			if i > start {
+				q = append(q, queryStep{kind: queryStepField, name: expr[start:i]})
+			} else if (i < len(expr) && expr[i] != '[') || (i == len(expr) && len(expr) > 1) {
+				// a lone . is the whole value, and .[0] the same as [0]
+				err = fmt.Errorf("Missing field name after . at position %d in query: %s", start-1, expr)
+				return
+			}
+		case expr[i] == '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				err = fmt.Errorf("Missing ] in query: %s", expr)
+				return
+			}
+			inner := strings.TrimSpace(expr[i+1 : i+end])
+			i += end + 1
+			switch {
+			case len(inner) == 0:
+				q = append(q, queryStep{kind: queryStepIterate})
+			case strings.HasPrefix(inner, "?"):
+				step := queryStep{kind: queryStepFilter}
+				cond := inner[1:]
+				op := "="
+				if strings.Contains(cond, "!=") {
+					op = "!="
+					step.negate = true
+				} else if strings.Contains(cond, "==") {
+					op = "=="
+				}
+				parts := strings.SplitN(cond, op, 2)
+				if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+					err = fmt.Errorf("Invalid filter in query: [%s]", inner)
+					return
+				}
+				step.name = strings.TrimPrefix(strings.TrimSpace(parts[0]), ".")
+				step.value = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+				q = append(q, step)
+			default:
+				n, err2 := strconv.Atoi(inner)
+				if err2 != nil {
+					err = fmt.Errorf("Invalid index in query: [%s]", inner)
+					return
+				}
+				q = append(q, queryStep{kind: queryStepIndex, index: n})
+			}
+		case isQueryNameChar(expr[i]) && i == 0:
+			// allow the leading . to be left off
+			start := i
+			for i < len(expr) && isQueryNameChar(expr[i]) {
+				i++
+			}
+			q = append(q, queryStep{kind: queryStepField, name: expr[start:i]})
+		default:
+			err = fmt.Errorf("Unexpected %q at position %d in query: %s", expr[i], i, expr)
+			return
+		}
+	}
+	return
+}
+
+func queryField(v interface{}, name string) interface{} {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if val, ok := obj[name]; ok {
+		return val
+	}
+	want := normalizeQueryName(name)
+	for k, val := range obj {
+		if normalizeQueryName(k) == want {
+			return val
+		}
+	}
+	return nil
+}
+
+// eval runs the query on data. Once a [] step is seen the result is a list
+// with one entry per element reached.
+func (q query) eval(data interface{}) (result interface{}, err error) {
+	current := []interface{}{data}
+	iterated := false
+	for _, step := range q {
+		next := make([]interface{}, 0, len(current))
+		for _, v := range current {
+			switch step.kind {
+			case queryStepField:
+				next = append(next, queryField(v, step.name))
+			case queryStepIterate:
+				list, ok := v.([]interface{})
+				if !ok {
+					if v == nil {
+						continue
+					}
+					err = errors.New("Can not iterate over a value which is not a list")
+					return
+				}
+				next = append(next, list...)
+			case queryStepIndex:
+				list, ok := v.([]interface{})
+				if !ok {
+					next = append(next, nil)
+					continue
+				}
+				idx := step.index
+				if idx < 0 {
+					idx += len(list)
+				}
+				if idx < 0 || idx >= len(list) {
+					next = append(next, nil)
+				} else {
+					next = append(next, list[idx])
+				}
+			case queryStepFilter:
+				list, ok := v.([]interface{})
+				if !ok {
+					err = errors.New("Can not filter a value which is not a list")
+					return
+				}
+				kept := []interface{}{}
+				for _, u := range list {
+					match := tableCellString(queryField(u, step.name)) == step.value
+					if match != step.negate {
+						kept = append(kept, u)
+					}
+				}
+				next = append(next, kept)
+			}
+		}
+		if step.kind == queryStepIterate {
+			iterated = true
+		}
+		current = next
+	}
+	if iterated {
+		result = current
+	} else if len(current) > 0 {
+		result = current[0]
+	}
+	return
+}
+
+// filterStage is a built in command which can follow a | and works on the
+// structured output of the command before it
+type filterStage func(data interface{}, args []string) (interface{}, error)
+
+var filterStages = map[string]filterStage{
+	"select": selectStage,
+}
+
+func selectStage(data interface{}, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Usage: | select <query>")
+	}
+	q, err := parseQuery(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return q.eval(data)
+}
+
+// extractQueryFlag removes --query <expr> or --query=<expr> from args
+func extractQueryFlag(args []string) (rest []string, expr string, err error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--query":
+			if i+1 >= len(args) {
+				err = errors.New("--query needs an expression")
+				return
+			}
+			i++
+			expr = args[i]
+		case strings.HasPrefix(arg, "--query="):
+			expr = strings.TrimPrefix(arg, "--query=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return
+}
+
+// splitPipeline splits args on | into a command and its filter stages
+func splitPipeline(args []string) (stages [][]string) {
+	start := 0
+	for i, arg := range args {
+		if arg == "|" {
+			stages = append(stages, args[start:i])
+			start = i + 1
+		}
+	}
+	return append(stages, args[start:])
+}
+
+func isQueryScalar(v interface{}) bool {
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	return true
+}
+
+// formatQueryResult prints scalars, and lists of scalars, one per line in
+// pretty mode. Anything else is rendered in the current output mode.
+func formatQueryResult(result interface{}) (out string, err error) {
+	if outputMode == OutputPretty {
+		if isQueryScalar(result) {
+			return tableCellString(result), nil
+		}
+		if list, ok := result.([]interface{}); ok {
+			lines := make([]string, 0, len(list))
+			for _, v := range list {
+				if !isQueryScalar(v) {
+					lines = nil
+					break
+				}
+				lines = append(lines, tableCellString(v))
+			}
+			if lines != nil {
+				return strings.Join(lines, "\n"), nil
+			}
+		}
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	out, err = formatOutput("", b)
+	out = strings.Trim(out, "\n")
+	return
+}
+
+// runPipeline runs the command in the first stage with JSON output, then
+// feeds the decoded result through the query, if any, and the filter stages
+func runPipeline(stages [][]string, expr string) (out string, err error) {
+	var q query
+	if len(expr) > 0 {
+		if q, err = parseQuery(expr); err != nil {
+			return
+		}
+	}
+	for _, stage := range stages[1:] {
+		if len(stage) < 1 {
+			err = errors.New("Empty stage after |")
+			return
+		}
+		if _, ok := filterStages[stage[0]]; !ok {
+			err = fmt.Errorf("no filter: %s", stage[0])
+			return
+		}
+	}
+
+	if len(stages[0]) < 1 {
+		err = errors.New("Missing command before |")
+		return
+	}
+	// check before running the command, which may change something
+	if spec, n := findCommand(stages[0]); spec != nil && !spec.isGroup() && !spec.isQueryable() {
+		err = fmt.Errorf("%s does not return data which can be queried", strings.Join(stages[0][:n], " "))
+		return
+	}
+	mode := outputMode
+	outputMode = OutputJSON
+	raw, err := runCommand(stages[0])
+	outputMode = mode
+	if err != nil {
+		return
+	}
+
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+	if err = dec.Decode(&data); err != nil {
+		err = fmt.Errorf("%s did not return data which can be queried", strings.Join(stages[0], " "))
+		return
+	}
+	if q != nil {
+		if data, err = q.eval(data); err != nil {
+			return
+		}
+	}
+	for _, stage := range stages[1:] {
+		if data, err = filterStages[stage[0]](data, stage); err != nil {
+			return
+		}
+	}
+	return formatQueryResult(data)
+}
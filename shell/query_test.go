@@ -0,0 +1,157 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		expr string
+		want query
+		// err, if set, is the start of the expected error
+		err string
+	}{
+		{expr: ".IfName", want: query{{kind: queryStepField, name: "IfName"}}},
+		{expr: "IfName", want: query{{kind: queryStepField, name: "IfName"}}},
+		{expr: " .if_name ", want: query{{kind: queryStepField, name: "if_name"}}},
+		{expr: ".", want: nil},
+		{expr: "[]", want: query{{kind: queryStepIterate}}},
+		{expr: ".[0]", want: query{{kind: queryStepIndex, index: 0}}},
+		{expr: "[2]", want: query{{kind: queryStepIndex, index: 2}}},
+		{expr: "[-1]", want: query{{kind: queryStepIndex, index: -1}}},
+		{expr: "[?Type=wifi]", want: query{{kind: queryStepFilter, name: "Type", value: "wifi"}}},
+		{expr: "[?type != 'eth']", want: query{{kind: queryStepFilter, name: "type", value: "eth", negate: true}}},
+		{expr: `[?.if_name=="eth0"]`, want: query{{kind: queryStepFilter, name: "if_name", value: "eth0"}}},
+		{expr: ".a[].b", want: query{
+			{kind: queryStepField, name: "a"},
+			{kind: queryStepIterate},
+			{kind: queryStepField, name: "b"},
+		}},
+		{expr: "", err: "Empty query"},
+		{expr: "  ", err: "Empty query"},
+		{expr: "..", err: "Missing field name after ."},
+		{expr: ".a.", err: "Missing field name after ."},
+		{expr: "a..b", err: "Missing field name after ."},
+		{expr: "[1", err: "Missing ]"},
+		{expr: "[x]", err: "Invalid index"},
+		{expr: "[1.5]", err: "Invalid index"},
+		{expr: "[?=x]", err: "Invalid filter"},
+		{expr: "[?type]", err: "Invalid filter"},
+		{expr: ".a b", err: "Unexpected ' '"},
+		{expr: "$", err: "Unexpected '$'"},
+		{expr: ".a]", err: "Unexpected ']'"},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.expr)
+		if len(tt.err) > 0 {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("parseQuery(%q) error = %v, want %q...", tt.expr, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQuery(%q) unexpected error: %s", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(q, tt.want) {
+			t.Errorf("parseQuery(%q) = %+v, want %+v", tt.expr, q, tt.want)
+		}
+	}
+}
+
+const queryTestData = `{
+	"count": 2,
+	"interfaces": [
+		{"if_name": "eth0", "type": "eth", "ipv4_mask": 24, "alias": [1, 2]},
+		{"if_name": "wlan0", "type": "wifi", "ipv4_mask": 0}
+	]
+}`
+
+func TestQueryEval(t *testing.T) {
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(queryTestData)))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		// want is the result as JSON
+		want string
+		err  string
+	}{
+		{expr: ".count", want: `2`},
+		{expr: ".nope", want: `null`},
+		{expr: ".Interfaces[].IfName", want: `["eth0","wlan0"]`},
+		{expr: ".INTERFACES[0].IPv4-Mask", want: `24`},
+		{expr: ".interfaces[1].if-name", want: `"wlan0"`},
+		{expr: ".interfaces[-1].if_name", want: `"wlan0"`},
+		{expr: ".interfaces[-2].if_name", want: `"eth0"`},
+		{expr: ".interfaces[-3]", want: `null`},
+		{expr: ".interfaces[2]", want: `null`},
+		{expr: ".count[0]", want: `null`},
+		{expr: ".interfaces[].alias[]", want: `[1,2]`},
+		{expr: ".missing[]", want: `[]`},
+		{expr: ".interfaces[?type=wifi][].if_name", want: `["wlan0"]`},
+		{expr: ".interfaces[?Type!=wifi][].IfName", want: `["eth0"]`},
+		{expr: ".interfaces[?IPv4Mask=24][].if_name", want: `["eth0"]`},
+		{expr: ".interfaces[?type=lte]", want: `[]`},
+		{expr: ".count[]", err: "Can not iterate"},
+		{expr: ".count[?a=b]", err: "Can not filter"},
+		{expr: "[?a=b]", err: "Can not filter"},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.expr)
+		if err != nil {
+			t.Errorf("parseQuery(%q) unexpected error: %s", tt.expr, err)
+			continue
+		}
+		result, err := q.eval(data)
+		if len(tt.err) > 0 {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("eval(%q) error = %v, want %q...", tt.expr, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("eval(%q) unexpected error: %s", tt.expr, err)
+			continue
+		}
+		got, _ := json.Marshal(result)
+		if string(got) != tt.want {
+			t.Errorf("eval(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestQueryEvalWhole(t *testing.T) {
+	q, err := parseQuery(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"a": "b"}
+	result, err := q.eval(data)
+	if err != nil || !reflect.DeepEqual(result, data) {
+		t.Errorf("eval(.) = %v, %v, want %v", result, err, data)
+	}
+}
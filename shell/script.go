@@ -0,0 +1,162 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// scripts may source other scripts, but not forever
+const maxScriptDepth = 16
+
+var scriptDepth = 0
+
+// reportedError is an error which has already been printed, with the file
+// and line it came from, so it is not printed again further up
+type reportedError struct {
+	error
+}
+
+// reported prints err, unless it has been already, and returns it marked
+// as printed
+func reported(err error) error {
+	if _, ok := err.(reportedError); ok {
+		return err
+	}
+	printError(err)
+	return reportedError{err}
+}
+
+// endsWithContinuation is true if the line ends in an unescaped backslash
+func endsWithContinuation(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// runScript runs each command read from r through the same dispatch as the
+// prompt. Blank lines and lines starting with # are skipped, and a line
+// ending in a backslash is joined with the next one. Unless continueOnError
+// is set, the first failing command stops the script. A failing command's
+// error is printed once, with its file and line.
+func runScript(r io.Reader, name string, continueOnError bool) (err error) {
+	if scriptDepth >= maxScriptDepth {
+		return fmt.Errorf("%s: scripts nested too deeply", name)
+	}
+	scriptDepth++
+	defer func() { scriptDepth-- }()
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	failed := 0
+	var cmd strings.Builder
+	cmdLine := 0
+
+	for {
+		more := scanner.Scan()
+		if more {
+			lineNo++
+			line := strings.TrimRight(scanner.Text(), " \t\r")
+			if cmd.Len() == 0 {
+				trimmed := strings.TrimSpace(line)
+				if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+					continue
+				}
+				cmdLine = lineNo
+			}
+			if endsWithContinuation(line) {
+				cmd.WriteString(line[:len(line)-1])
+				continue
+			}
+			cmd.WriteString(line)
+		} else if cmd.Len() == 0 {
+			break
+		}
+
+		DebugOut("%s:%d: %s", name, cmdLine, redactSecrets(cmd.String()))
+		argz, err2 := SplitArgs(cmd.String())
+		if err2 == nil {
+			var out string
+			out, err2 = runArgs(argz)
+			if len(out) > 0 {
+				fmt.Println(out)
+			}
+		}
+		cmd.Reset()
+		if err2 != nil {
+			failed++
+			if _, ok := err2.(reportedError); !ok {
+				err2 = reported(fmt.Errorf("%s:%d: %s", name, cmdLine, errorString(err2)))
+			}
+			if !continueOnError {
+				return err2
+			}
+		}
+		if !more {
+			break
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%s: %d commands failed", name, failed)
+	}
+	return
+}
+
+// RunScript runs the commands in the given file. See runScript. Errors are
+// printed as they happen, so the error returned needs no printing.
+func RunScript(path string, continueOnError bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return reported(err)
+	}
+	defer f.Close()
+	if err = runScript(f, path, continueOnError); err != nil {
+		return reported(err)
+	}
+	return nil
+}
+
+func cmdSource(args []string) (out string, err error) {
+	continueOnError := false
+	var path string
+	for _, arg := range args[1:] {
+		if arg == "--continue-on-error" {
+			continueOnError = true
+		} else if len(path) == 0 {
+			path = arg
+		} else {
+			err = errors.New("Usage: source [--continue-on-error] <file>")
+			return
+		}
+	}
+	if len(path) == 0 {
+		err = errors.New("Usage: source [--continue-on-error] <file>")
+		return
+	}
+	err = RunScript(path, continueOnError)
+	return
+}
@@ -0,0 +1,341 @@
+package shell
+
+// Copyright (c) 2018, Arm Limited and affiliates.
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	defaultTerminalWidth = 80
+	tableColumnGap       = "  "
+	minTableColumnWidth  = 4
+)
+
+// tableColumn describes one column of a table made from JSON records
+type tableColumn struct {
+	Header string
+	// Key is the JSON field shown in this column, unless Value is set
+	Key string
+	// Value, if set, builds the cell from the whole record
+	Value func(rec map[string]interface{}) string
+	// Wide columns are only shown with --wide
+	Wide bool
+}
+
+func (col *tableColumn) cell(rec map[string]interface{}) string {
+	if col.Value != nil {
+		return col.Value(rec)
+	}
+	return tableCellString(rec[col.Key])
+}
+
+// tableOptions are the per command table flags
+type tableOptions struct {
+	// Wide shows all columns and never truncates
+	Wide bool
+	// Columns, if not empty, are the headers of the columns to show
+	Columns []string
+}
+
+// extractTableFlags removes --wide and --columns=a,b,c from args
+func extractTableFlags(args []string) (rest []string, opts tableOptions, err error) {
+	for _, arg := range args {
+		switch {
+		case arg == "--wide":
+			opts.Wide = true
+		case strings.HasPrefix(arg, "--columns="):
+			for _, c := range strings.Split(strings.TrimPrefix(arg, "--columns="), ",") {
+				if c = strings.TrimSpace(c); len(c) > 0 {
+					opts.Columns = append(opts.Columns, c)
+				}
+			}
+			if len(opts.Columns) < 1 {
+				err = fmt.Errorf("--columns needs a comma separated list of columns")
+				return
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return
+}
+
+func tableCellString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case json.Number:
+		return val.String()
+	case []interface{}:
+		parts := make([]string, 0, len(val))
+		for _, u := range val {
+			parts = append(parts, tableCellString(u))
+		}
+		return strings.Join(parts, ",")
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+// terminalWidth returns the width of stdout. ok is false if stdout is not
+// a terminal, such as when piped, and tables are not fitted to it.
+func terminalWidth() (width int, ok bool) {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return
+	}
+	ok = true
+	if cols, _, err := term.GetSize(fd); err == nil && cols > 0 {
+		width = cols
+	} else if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		width = cols
+	} else {
+		width = defaultTerminalWidth
+	}
+	return
+}
+
+func truncateCell(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "~"
+}
+
+// selectColumns picks the columns to show given the table options
+func selectColumns(columns []tableColumn, opts tableOptions) (cols []tableColumn, err error) {
+	if len(opts.Columns) > 0 {
+		for _, name := range opts.Columns {
+			found := false
+			for _, col := range columns {
+				if strings.EqualFold(col.Header, name) {
+					cols = append(cols, col)
+					found = true
+					break
+				}
+			}
+			if !found {
+				headers := make([]string, 0, len(columns))
+				for _, col := range columns {
+					headers = append(headers, col.Header)
+				}
+				err = fmt.Errorf("Unknown column %s, must be one of %s", name, strings.Join(headers, ","))
+				return
+			}
+		}
+		return
+	}
+	for _, col := range columns {
+		if opts.Wide || !col.Wide {
+			cols = append(cols, col)
+		}
+	}
+	return
+}
+
+// renderTable renders one row per record. Unless opts.Wide is set, the
+// widest columns are truncated until the table fits the terminal.
+func renderTable(columns []tableColumn, records []map[string]interface{}, opts tableOptions) (out string, err error) {
+	cols, err := selectColumns(columns, opts)
+	if err != nil {
+		return
+	}
+
+	rows := make([][]string, 0, len(records)+1)
+	widths := make([]int, len(cols))
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = col.Header
+		widths[i] = utf8.RuneCountInString(col.Header)
+	}
+	rows = append(rows, header)
+	for _, rec := range records {
+		row := make([]string, len(cols))
+		for i := range cols {
+			row[i] = cols[i].cell(rec)
+			if w := utf8.RuneCountInString(row[i]); w > widths[i] {
+				widths[i] = w
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if max, ok := terminalWidth(); ok && !opts.Wide {
+		for {
+			total := len(tableColumnGap) * (len(widths) - 1)
+			widest := 0
+			for i, w := range widths {
+				total += w
+				if w > widths[widest] {
+					widest = i
+				}
+			}
+			if total <= max || widths[widest] <= minTableColumnWidth {
+				break
+			}
+			widths[widest]--
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteString(tableColumnGap)
+			}
+			cell = truncateCell(cell, widths[i])
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			}
+		}
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteString("\n")
+	}
+	out = strings.TrimRight(buf.String(), "\n")
+	return
+}
+
+// decodeRecords decodes a JSON array of objects, keeping numbers as
+// json.Number so integers print as integers
+func decodeRecords(rawjson []byte) (records []map[string]interface{}, err error) {
+	dec := json.NewDecoder(bytes.NewReader(rawjson))
+	dec.UseNumber()
+	err = dec.Decode(&records)
+	return
+}
+
+func recordString(rec map[string]interface{}, key string) string {
+	return tableCellString(rec[key])
+}
+
+var interfaceColumns = []tableColumn{
+	{Header: "IfName", Key: "if_name"},
+	{Header: "IfIndex", Key: "if_index", Wide: true},
+	{Header: "Type", Key: "type"},
+	{Header: "DHCP", Key: "dhcpv4"},
+	{Header: "IPv4Addr/Mask", Value: func(rec map[string]interface{}) string {
+		addr := recordString(rec, "ipv4_addr")
+		if len(addr) == 0 {
+			return ""
+		}
+		return addr + "/" + recordString(rec, "ipv4_mask")
+	}},
+	{Header: "Aliases", Value: func(rec map[string]interface{}) string {
+		aliases, _ := rec["alias_ipv4"].([]interface{})
+		addrs := make([]string, 0, len(aliases))
+		for _, a := range aliases {
+			if alias, ok := a.(map[string]interface{}); ok {
+				addrs = append(addrs, recordString(alias, "ipv4_addr")+"/"+recordString(alias, "ipv4_mask"))
+			}
+		}
+		return strings.Join(addrs, ",")
+	}},
+	{Header: "Gateway", Key: "default_gateway"},
+	{Header: "RoutePriority", Key: "route_priority"},
+	{Header: "Down", Key: "down"},
+	{Header: "HwAddr", Key: "hw_addr", Wide: true},
+	{Header: "IPv6Addr", Key: "ipv6_addr", Wide: true},
+	{Header: "WifiSsid", Key: "wifi_ssid", Wide: true},
+	{Header: "Routes", Key: "routes", Wide: true},
+	{Header: "Aux", Key: "aux", Wide: true},
+	{Header: "Existing", Key: "existing", Wide: true},
+}
+
+var connectivityColumns = []tableColumn{
+	{Header: "Test", Key: "test"},
+	{Header: "Target", Key: "target"},
+	{Header: "Ok", Key: "ok"},
+	{Header: "LastRun", Key: "last_run"},
+	{Header: "Error", Key: "error"},
+}
+
+var jobColumns = []tableColumn{
+	{Header: "Job", Key: "job"},
+	{Header: "Status", Key: "status"},
+	{Header: "Pid", Key: "pid"},
+}
+
+var dnsColumns = []tableColumn{
+	{Header: "Nameserver", Key: "nameserver"},
+}
+
+// dnsRecords makes one record per nameserver, from either a plain list or
+// an object with a nameservers list
+func dnsRecords(rawjson []byte) (records []map[string]interface{}, err error) {
+	var data interface{}
+	if err = json.Unmarshal(rawjson, &data); err != nil {
+		return
+	}
+	if obj, ok := data.(map[string]interface{}); ok {
+		data = obj["nameservers"]
+	}
+	list, _ := data.([]interface{})
+	for _, ns := range list {
+		records = append(records, map[string]interface{}{"nameserver": tableCellString(ns)})
+	}
+	return
+}
+
+var logFilterColumns = []tableColumn{
+	{Header: "Target", Key: "target"},
+	{Header: "Levels", Key: "levels"},
+	{Header: "Tag", Key: "tag"},
+	{Header: "Pre", Key: "format_pre", Wide: true},
+	{Header: "Post", Key: "format_post", Wide: true},
+	{Header: "PostFmtPreMsg", Key: "format_post_pre_msg", Wide: true},
+}
+
+// logTargetRecords flattens log targets into one record per filter
+func logTargetRecords(rawjson []byte) (records []map[string]interface{}, err error) {
+	targets, err := decodeRecords(rawjson)
+	if err != nil {
+		return
+	}
+	for _, target := range targets {
+		name := recordString(target, "name")
+		filters, _ := target["filters"].([]interface{})
+		if len(filters) == 0 {
+			records = append(records, map[string]interface{}{"target": name})
+			continue
+		}
+		for _, f := range filters {
+			if rec, ok := f.(map[string]interface{}); ok {
+				if len(recordString(rec, "target")) == 0 {
+					rec["target"] = name
+				}
+				records = append(records, rec)
+			}
+		}
+	}
+	return
+}